@@ -0,0 +1,195 @@
+package polygenlib
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Annotations are the metadata declared by directives in the doc comment
+// of a package, interface, method, struct, field, enum or named scalar.
+// Each directive is a line of the form:
+//
+//	//polygen:key value
+//
+// The value is optional for some keys, and is empty if omitted.
+type Annotations map[string]string
+
+// Has returns true if the annotation key was given
+func (a Annotations) Has(key string) bool {
+	_, ok := a[key]
+	return ok
+}
+
+const annotationPrefix = "//polygen:"
+
+// annotationTarget is the kind of declaration an annotation is attached to
+type annotationTarget int
+
+const (
+	onInterface annotationTarget = 1 << iota
+	onMethod
+	onStruct
+	onField
+	onEnum
+	onPackage
+)
+
+var annotationTargetNames = map[annotationTarget]string{
+	onInterface: "interfaces",
+	onMethod:    "methods",
+	onStruct:    "structs",
+	onField:     "fields",
+	onEnum:      "enums or named scalars",
+	onPackage:   "packages",
+}
+
+// annotationValue is whether an annotation key takes a value
+type annotationValue int
+
+const (
+	noValue annotationValue = iota
+	optionalValue
+	requiredValue
+)
+
+// annotationRule describes where an annotation key may be used and what
+// values it accepts
+type annotationRule struct {
+	targets annotationTarget
+	value   annotationValue
+	check   func(val string) error
+}
+
+// annotationRules are the known annotation keys. notification,
+// idempotent, timeout and role are metadata only: they are kept in the
+// model for generators and tools to read, but the generated code ignores
+// them. In particular a notification method, which may not return a
+// value, is still dispatched and answered like any other method.
+var annotationRules = map[string]annotationRule{
+	"deprecated":   {onInterface | onMethod | onStruct | onField | onEnum, optionalValue, nil},
+	"notification": {onMethod, noValue, nil},
+	"idempotent":   {onMethod, noValue, nil},
+	"timeout":      {onInterface | onMethod, requiredValue, checkTimeout},
+	"role":         {onInterface | onMethod, requiredValue, nil},
+	"error":        {onStruct, requiredValue, checkErrorCode},
+	"throws":       {onMethod, requiredValue, nil},
+	"union":        {onStruct, optionalValue, checkDiscriminator},
+	"wire":         {onPackage, requiredValue, checkWireCase},
+	"int64":        {onPackage, requiredValue, checkInt64Encoding},
+}
+
+// checkTimeout checks a timeout is a positive Go duration, such as 30s
+func checkTimeout(val string) error {
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("'timeout' must be a positive duration such as 30s (not %s)", val)
+	}
+	return nil
+}
+
+// checkErrorCode checks an error code is an integer outside the range
+// reserved by JSON-RPC
+func checkErrorCode(val string) error {
+	code, err := strconv.Atoi(val)
+	if err != nil {
+		return fmt.Errorf("'error' code must be an integer (not %s)", val)
+	} else if code >= -32768 && code <= -32000 {
+		return fmt.Errorf("'error' code %d is reserved by JSON-RPC", code)
+	}
+	return nil
+}
+
+// visitPackageAnnotations records the options declared in the doc comment
+// of the package clause of a file. All files declaring an option must
+// agree on its value.
+func (v *Visitor) visitPackageAnnotations(f *ast.File) {
+	a := v.parseAnnotations(f.Doc, onPackage)
+	v.setPackageOption(f, a, "wire", "Wire case", &v.pkg.WireCase)
+	v.setPackageOption(f, a, "int64", "int64 encoding", &v.pkg.Int64Encoding)
+}
+
+// setPackageOption sets opt to the value of the annotation key in a, if
+// there is one, unless another file declared a different value
+func (v *Visitor) setPackageOption(f *ast.File, a Annotations, key string, desc string, opt *string) {
+	if !a.Has(key) {
+		return
+	}
+	if *opt != "" && *opt != a[key] {
+		msg := fmt.Sprintf("%s %s does not match %s declared in another file", desc, a[key], *opt)
+		v.AddErr(v.nodeErr(f.Name, CodeInvalidAnnotationValue, msg))
+		return
+	}
+	*opt = a[key]
+}
+
+// parseAnnotations returns the annotations in the comment group cg, which
+// documents a declaration of the given kind. Invalid annotations are
+// added to the visitor as errors. Returns nil if there are none.
+func (v *Visitor) parseAnnotations(cg *ast.CommentGroup, target annotationTarget) Annotations {
+	if cg == nil {
+		return nil
+	}
+	var a Annotations
+	for _, c := range cg.List {
+		if !strings.HasPrefix(c.Text, annotationPrefix) {
+			continue
+		}
+		directive := strings.TrimSpace(c.Text[len(annotationPrefix):])
+		key := directive
+		val := ""
+		if i := strings.IndexAny(directive, " \t"); i >= 0 {
+			key = directive[0:i]
+			val = strings.TrimSpace(directive[i:])
+		}
+
+		if a.Has(key) {
+			v.AddErr(v.nodeErr(c, CodeDuplicateAnnotation, "Duplicate annotation: "+key))
+			continue
+		} else if code, msg := checkAnnotation(key, val, target); code != "" {
+			v.AddErr(v.nodeErr(c, code, msg))
+			continue
+		}
+
+		if a == nil {
+			a = make(Annotations)
+		}
+		a[key] = val
+	}
+	return a
+}
+
+// checkAnnotation checks the annotation key with value val may be used on
+// a declaration of the given kind. Returns the code and message of the
+// error if not, or an empty code if it may.
+func checkAnnotation(key string, val string, target annotationTarget) (string, string) {
+	rule, ok := annotationRules[key]
+	if !ok {
+		return CodeUnknownAnnotation, "Unknown annotation: " + key
+	} else if rule.targets&target == 0 {
+		return CodeMisplacedAnnotation, fmt.Sprintf("Annotation '%s' is not allowed on %s", key, annotationTargetNames[target])
+	}
+
+	if rule.value == requiredValue && val == "" {
+		return CodeInvalidAnnotationValue, fmt.Sprintf("Annotation '%s' requires a value", key)
+	} else if rule.value == noValue && val != "" {
+		return CodeInvalidAnnotationValue, fmt.Sprintf("Annotation '%s' does not take a value", key)
+	}
+	if rule.check != nil {
+		if err := rule.check(val); err != nil {
+			return CodeInvalidAnnotationValue, err.Error()
+		}
+	}
+	return "", ""
+}
+
+// deprecatedDocTags returns the @deprecated tag for the doc comment of a
+// declaration with the given annotations, or nil if it is not deprecated
+func deprecatedDocTags(a Annotations) []string {
+	if !a.Has("deprecated") {
+		return nil
+	}
+	return []string{strings.TrimSpace("@deprecated " + a["deprecated"])}
+}
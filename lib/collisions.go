@@ -0,0 +1,91 @@
+package polygenlib
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// declaredName is a name declared in the IDL. what describes the
+// declaration, e.g. "Field Person.userId".
+type declaredName struct {
+	what string
+	name string
+	pos  token.Position
+}
+
+// nameScope holds the names declared in a scope, such as the fields of a
+// struct, keyed by their lowercase form. Names that differ only in case
+// collide, as generated code may lowercase them (see VarName) or use
+// them as file names on a case-insensitive file system.
+type nameScope map[string]declaredName
+
+// declare adds d to the scope. If it collides with a name already in the
+// scope, an error is added and false is returned.
+func (v *Visitor) declare(scope nameScope, d declaredName) bool {
+	key := strings.ToLower(d.name)
+	prev, ok := scope[key]
+	if !ok {
+		scope[key] = d
+		return true
+	}
+	v.AddErr(collisionErr(prev, d))
+	return false
+}
+
+// collisionErr returns the error for the name d, which collides with the
+// earlier declaration prev
+func collisionErr(prev declaredName, d declaredName) *PolyError {
+	var msg string
+	if prev.name == d.name {
+		msg = fmt.Sprintf("%s is already declared at %s:%d", d.what, prev.pos.Filename, prev.pos.Line)
+	} else {
+		msg = fmt.Sprintf("%s differs only in case from %s at %s:%d", d.what,
+			lowerFirst(prev.what), prev.pos.Filename, prev.pos.Line)
+	}
+	e := posErr(d.pos, CodeDuplicateName, msg)
+	e.Related = []PolyError{*posErr(prev.pos, "", prev.what+" is declared here")}
+	return e
+}
+
+// lowerFirst returns s with its first letter lowercased
+func lowerFirst(s string) string {
+	return strings.ToLower(s[0:1]) + s[1:]
+}
+
+// checkTypeNames checks the names of the structs, enums, named scalars,
+// interfaces and constants of the package are unique
+func (v *Visitor) checkTypeNames() {
+	scope := make(nameScope)
+	for _, s := range v.pkg.Structs {
+		v.declare(scope, declaredName{"Struct " + s.Name, s.Name, s.Pos})
+	}
+	for _, e := range v.pkg.Enums {
+		v.declare(scope, declaredName{"Enum " + e.Name, e.Name, e.Pos})
+	}
+	for _, sc := range v.pkg.Scalars {
+		v.declare(scope, declaredName{"Type " + sc.Name, sc.Name, sc.Pos})
+	}
+	for _, iface := range v.pkg.Interfaces {
+		v.declare(scope, declaredName{"Interface " + iface.Name, iface.Name, iface.Pos})
+	}
+	for _, c := range v.pkg.Constants {
+		v.declare(scope, declaredName{"Constant " + c.Name, c.Name, c.Pos})
+	}
+}
+
+// checkMethodNames checks the methods of each interface, and the
+// arguments of each method, have unique names
+func (v *Visitor) checkMethodNames() {
+	for _, iface := range v.pkg.Interfaces {
+		methods := make(nameScope)
+		for _, m := range iface.Methods {
+			qual := iface.Name + "." + m.Name
+			v.declare(methods, declaredName{"Method " + qual, m.Name, m.Pos})
+			args := make(nameScope)
+			for _, arg := range m.Args {
+				v.declare(args, declaredName{"Argument " + arg.Name + " of " + qual, arg.Name, arg.Pos})
+			}
+		}
+	}
+}
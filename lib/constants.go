@@ -0,0 +1,118 @@
+package polygenlib
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// Constant is a named int, float, bool or string value declared in the
+// IDL with a literal value, e.g.
+//
+//	// MaxPageSize is the largest page a List method returns
+//	const MaxPageSize = 100
+//
+// Constants are emitted by each generator so that client and server code
+// share a single definition.
+type Constant struct {
+	Name string
+	// Type is one of the int, float, bool or string builtins
+	Type PolyType
+	// Value is the value in canonical form: a decimal integer, a float
+	// formatted by formatFloat, true or false, or the unquoted string
+	Value   string
+	Comment string
+	Pos     token.Position
+}
+
+// FindConstant returns the constant with the given name, or nil if the
+// package has no such constant
+func (p *Package) FindConstant(name string) *Constant {
+	for i := 0; i < len(p.Constants); i++ {
+		if p.Constants[i].Name == name {
+			return &p.Constants[i]
+		}
+	}
+	return nil
+}
+
+// constantTypes are the builtins a constant may be declared with
+var constantTypes = map[string]bool{"int": true, "float": true, "bool": true, "string": true}
+
+// visitConstant records the constants declared by spec, which is either
+// untyped or typed with one of the constantTypes
+func (v *Visitor) visitConstant(spec *ast.ValueSpec, doc *ast.CommentGroup) {
+	pos := v.fs.Position(spec.Pos())
+	gotype := ""
+	if spec.Type != nil {
+		gotype = spec.Type.(*ast.Ident).Name
+	}
+	if len(spec.Values) != len(spec.Names) {
+		v.AddErr(v.nodeErr(spec, CodeInvalidConstant, "Constants must have a literal value"))
+		return
+	}
+	for i := 0; i < len(spec.Names); i++ {
+		t, val, err := constantValue(spec.Values[i], gotype)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid value for constant %s: %s", spec.Names[i].Name, err)
+			v.AddErr(v.nodeErr(spec.Values[i], CodeInvalidConstant, msg))
+			continue
+		}
+		c := Constant{spec.Names[i].Name, PolyType{GoType: t}, val, commentText(doc), pos}
+		v.pkg.Constants = append(v.pkg.Constants, c)
+	}
+}
+
+// constantValue returns the type and canonical value of the literal expr.
+// gotype is the declared type of the constant, or empty if it is untyped.
+func constantValue(expr ast.Expr, gotype string) (string, string, error) {
+	neg := false
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.SUB {
+		neg = true
+		expr = u.X
+	}
+
+	t, val := "", ""
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		lit := e.Value
+		if neg {
+			lit = "-" + lit
+		}
+		switch e.Kind {
+		case token.INT:
+			i, err := strconv.ParseInt(lit, 0, 64)
+			if err != nil {
+				return "", "", fmt.Errorf("%s does not fit in 64 bits", lit)
+			}
+			t, val = "int", strconv.FormatInt(i, 10)
+		case token.FLOAT:
+			f, err := strconv.ParseFloat(lit, 64)
+			if err != nil {
+				return "", "", fmt.Errorf("%s is not a valid float", lit)
+			}
+			t, val = "float", formatFloat(f)
+		case token.STRING:
+			s, err := strconv.Unquote(lit)
+			if err != nil || neg {
+				return "", "", fmt.Errorf("invalid string literal %s", lit)
+			}
+			t, val = "string", s
+		}
+	case *ast.Ident:
+		if !neg && (e.Name == "true" || e.Name == "false") {
+			t, val = "bool", e.Name
+		}
+	}
+	if t == "" {
+		return "", "", fmt.Errorf("must be an int, float, bool or string literal")
+	}
+
+	if gotype == "" || gotype == t {
+		return t, val, nil
+	} else if gotype == "float" && t == "int" {
+		return gotype, val, nil
+	}
+	return "", "", fmt.Errorf("%s literal may not be assigned to %s", t, gotype)
+}
@@ -0,0 +1,245 @@
+package polygenlib
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PolyError is an error in an IDL file. Line and Column give the start of
+// the offending source, and EndLine and EndColumn the position just after
+// it. Columns count bytes from 1, as in go/token.
+type PolyError struct {
+	Filename  string `json:"filename"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	// Code identifies the rule that was broken. Codes are stable, so tools
+	// may match on them rather than on the message.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Related are other places in the IDL involved in the error, such as
+	// the first declaration of a duplicate name
+	Related []PolyError `json:"related,omitempty"`
+}
+
+func (e PolyError) Error() string {
+	if e.Filename == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Filename, e.Line, e.Message)
+}
+
+// Error codes for each rule checked by the parser
+const (
+	CodeSyntax                 = "syntax"
+	CodeNotAllowed             = "not-allowed"
+	CodePackageMismatch        = "package-mismatch"
+	CodeIllegalType            = "illegal-type"
+	CodeUnsupportedType        = "unsupported-type"
+	CodeUnknownType            = "unknown-type"
+	CodeUnknownPackage         = "unknown-package"
+	CodeNotAType               = "not-a-type"
+	CodeDuplicateName          = "duplicate-name"
+	CodeDuplicateField         = "duplicate-field"
+	CodeInvalidMapKey          = "invalid-map-key"
+	CodeInvalidArrayLength     = "invalid-array-length"
+	CodeInvalidSetElem         = "invalid-set-element"
+	CodeInvalidMethod          = "invalid-method"
+	CodeEmptyInterface         = "empty-interface"
+	CodeInvalidNotification    = "invalid-notification"
+	CodeInvalidEnumValue       = "invalid-enum-value"
+	CodeDuplicateEnumValue     = "duplicate-enum-value"
+	CodeInvalidConstant        = "invalid-constant"
+	CodeInvalidTag             = "invalid-tag"
+	CodeInvalidDefault         = "invalid-default"
+	CodeInvalidEmbed           = "invalid-embed"
+	CodeEmbedCycle             = "embed-cycle"
+	CodeInvalidImport          = "invalid-import"
+	CodeImportErrors           = "import-errors"
+	CodeUnknownAnnotation      = "unknown-annotation"
+	CodeMisplacedAnnotation    = "misplaced-annotation"
+	CodeDuplicateAnnotation    = "duplicate-annotation"
+	CodeInvalidAnnotationValue = "invalid-annotation-value"
+	CodeDuplicateThrows        = "duplicate-throws"
+	CodeNotAnErrorType         = "not-an-error-type"
+	CodeDuplicateErrorCode     = "duplicate-error-code"
+	CodeInvalidUnion           = "invalid-union"
+	CodeReservedWord           = "reserved-word"
+	CodeInvalidIR              = "invalid-ir"
+)
+
+// posErr returns a PolyError for the given position in an IDL file. The
+// end of the error is found from the source once the file is parsed.
+func posErr(pos token.Position, code string, msg string) *PolyError {
+	return &PolyError{Filename: pos.Filename, Line: pos.Line, Column: pos.Column, Code: code, Message: msg}
+}
+
+// nodeErr returns a PolyError that spans the source of node
+func (v *Visitor) nodeErr(node ast.Node, code string, msg string) *PolyError {
+	e := posErr(v.fs.Position(node.Pos()), code, msg)
+	end := v.fs.Position(node.End())
+	e.EndLine = end.Line
+	e.EndColumn = end.Column
+	return e
+}
+
+// Errors returns the errors found while parsing
+func (v Visitor) Errors() []PolyError {
+	return v.errors
+}
+
+// ErrorList is a list of IDL errors found in a parsed Package, such as
+// those returned by an IdentifierChecker
+type ErrorList []PolyError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// nameErr returns a PolyError that spans the identifier name at pos
+func nameErr(pos token.Position, code string, name string, msg string) PolyError {
+	e := posErr(pos, code, msg)
+	e.EndLine = e.Line
+	e.EndColumn = e.Column + len(name)
+	return *e
+}
+
+// Diagnostics returns the IDL errors in err, as returned by the Parse
+// functions and IdentifierCheckers. Errors that are not about an IDL file, such as a missing
+// directory, are returned as a single PolyError with only a message.
+func Diagnostics(err error) []PolyError {
+	if v, ok := err.(*Visitor); ok {
+		return v.Errors()
+	}
+	if l, ok := err.(ErrorList); ok {
+		return l
+	}
+	return []PolyError{PolyError{Message: err.Error()}}
+}
+
+// addSyntaxErrors adds the errors returned by parser.ParseFile
+func (v *Visitor) addSyntaxErrors(err error) {
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		v.AddErr(&PolyError{Code: CodeSyntax, Message: err.Error()})
+		return
+	}
+	for _, e := range list {
+		v.AddErr(posErr(e.Pos, CodeSyntax, e.Msg))
+	}
+}
+
+// setErrorEnds sets the end position of errors in the file src that only
+// have a start position. The error is taken to span the identifier or
+// literal at its start, or a single character if there isn't one.
+func setErrorEnds(errs []PolyError, filename string, src []byte) {
+	lines := bytes.Split(src, []byte("\n"))
+	for i := 0; i < len(errs); i++ {
+		e := &errs[i]
+		setErrorEnds(e.Related, filename, src)
+		if e.Filename != filename || e.EndLine != 0 || e.Line < 1 || e.Line > len(lines) || e.Column < 1 {
+			continue
+		}
+		line := lines[e.Line-1]
+		end := e.Column - 1
+		for end < len(line) {
+			r, size := utf8.DecodeRune(line[end:])
+			if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.') {
+				break
+			}
+			end += size
+		}
+		if end == e.Column-1 {
+			end++
+		}
+		e.EndLine = e.Line
+		e.EndColumn = end + 1
+	}
+}
+
+// setAllErrorEnds calls setErrorEnds for each of the source files
+func setAllErrorEnds(errs []PolyError, files []File) {
+	for _, f := range files {
+		setErrorEnds(errs, f.Name, f.Contents)
+	}
+}
+
+// Excerpt returns the error followed by the line of src it starts on,
+// with the span of the error underlined by carets, e.g.
+//
+//	svc.go:5:11: error[invalid-map-key]: Map keys must be type string (not int)
+//	 5 | 	Tags map[int]string
+//	   | 	         ^^^
+//
+// src is the contents of the file the error is in. Only the error is
+// returned if src does not contain the error's line. Related errors
+// follow as notes, excerpted if they are in the same file.
+func (e PolyError) Excerpt(src []byte) string {
+	label := ""
+	if e.Code != "" {
+		label = fmt.Sprintf("error[%s]", e.Code)
+	}
+	out := e.excerpt(src, label)
+	for _, r := range e.Related {
+		rsrc := src
+		if r.Filename != e.Filename {
+			rsrc = nil
+		}
+		out += "\n" + r.excerpt(rsrc, "note")
+	}
+	return out
+}
+
+// excerpt returns the excerpt of e, with label before its message if
+// label is not empty
+func (e PolyError) excerpt(src []byte, label string) string {
+	head := e.Message
+	if label != "" {
+		head = fmt.Sprintf("%s: %s", label, e.Message)
+	}
+	if e.Filename != "" {
+		head = fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Line, e.Column, head)
+	}
+	lines := strings.Split(string(src), "\n")
+	if e.Line < 1 || e.Line > len(lines) || e.Column < 1 {
+		return head
+	}
+	line := strings.TrimRight(lines[e.Line-1], "\r")
+	start := e.Column - 1
+	if start > len(line) {
+		start = len(line)
+	}
+	end := len(line)
+	if e.EndLine == e.Line && e.EndColumn-1 <= len(line) && e.EndColumn-1 > start {
+		end = e.EndColumn - 1
+	}
+
+	// tabs are copied into the margin so the carets line up however
+	// they are displayed
+	margin := ""
+	for _, r := range line[0:start] {
+		if r == '\t' {
+			margin += "\t"
+		} else {
+			margin += " "
+		}
+	}
+	carets := strings.Repeat("^", utf8.RuneCountInString(line[start:end]))
+	if carets == "" {
+		carets = "^"
+	}
+	num := fmt.Sprintf("%d", e.Line)
+	pad := strings.Repeat(" ", len(num))
+	return fmt.Sprintf("%s\n %s | %s\n %s | %s%s", head, num, line, pad, margin, carets)
+}
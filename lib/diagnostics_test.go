@@ -0,0 +1,43 @@
+package polygenlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	idl := "package foo\n\ntype Person struct {\n\tTags map[int]string\n\tName strng\n}"
+	_, err := Parse("example1.go", idl)
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	expected := []PolyError{
+		{"example1.go", 4, 11, 4, 14, CodeInvalidMapKey, "Map keys must be type string (not int)", nil},
+		{"example1.go", 5, 2, 5, 6, CodeUnknownType, "Unknown type: strng (did you mean string?)", nil},
+	}
+	if !reflect.DeepEqual(Diagnostics(err), expected) {
+		t.Errorf("Unexpected errors: %v", Diagnostics(err))
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Parse("example1.go", "package foo\n\ntype Person struct {\n")
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	errs := Diagnostics(err)
+	if len(errs) != 1 || errs[0].Code != CodeSyntax || errs[0].Line != 3 || errs[0].Column == 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	src := []byte("package foo\n\ntype Person struct {\n\tTags map[int]string\n}")
+	e := PolyError{"example1.go", 4, 11, 4, 14, CodeInvalidMapKey, "Map keys must be type string (not int)", nil}
+	expected := "example1.go:4:11: error[invalid-map-key]: Map keys must be type string (not int)\n" +
+		" 4 | \tTags map[int]string\n" +
+		"   | \t         ^^^"
+	if e.Excerpt(src) != expected {
+		t.Errorf("Unexpected excerpt:\n%s", e.Excerpt(src))
+	}
+}
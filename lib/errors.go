@@ -0,0 +1,121 @@
+package polygenlib
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrorCode returns the JSON-RPC error code of s. ok is false if s is not
+// an error type. Error types are structs annotated with their code, e.g.
+//
+//	//polygen:error 404
+//	type NotFound struct {
+//		Id int
+//	}
+//
+// The fields of the struct are sent as the data of the JSON-RPC error.
+func (s *Struct) ErrorCode() (code int, ok bool) {
+	val, ok := s.Annotations["error"]
+	if !ok {
+		return 0, false
+	}
+	code, err := strconv.Atoi(val)
+	return code, err == nil
+}
+
+// visitMethodError records the error type returned as the second result
+// of m, as in:
+//
+//	Get(id int) (Person, NotFound)
+func (v *Visitor) visitMethodError(m *Method, f *ast.Field) {
+	t, err := newNamedPolyType(v, f, f.Type)
+	if err != nil {
+		v.AddErr(err)
+		return
+	}
+	v.addThrows(m, t)
+}
+
+// visitThrows records the error types listed by the throws annotation of
+// m, as in:
+//
+//	//polygen:throws NotFound, common.Forbidden
+func (v *Visitor) visitThrows(m *Method) {
+	names := strings.FieldsFunc(m.Annotations["throws"], func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, name := range names {
+		t := PolyType{GoType: name}
+		if i := strings.Index(name, "."); i >= 0 {
+			pkg := v.fileImports[name[0:i]]
+			if pkg == nil {
+				v.AddErr(posErr(m.Pos, CodeUnknownPackage, "Unknown package: "+name[0:i]))
+				continue
+			}
+			t = PolyType{GoType: name[i+1:], Package: pkg.Name}
+			if pkg.FindStruct(t.GoType) == nil {
+				v.AddErr(posErr(m.Pos, CodeUnknownType, "Unknown type "+name))
+				continue
+			}
+		}
+		v.addThrows(m, t)
+	}
+}
+
+func (v *Visitor) addThrows(m *Method, t PolyType) {
+	for _, prev := range m.Throws {
+		if prev == t {
+			v.AddErr(posErr(m.Pos, CodeDuplicateThrows, fmt.Sprintf("Method %s declares error %s more than once",
+				m.Name, t.QualifiedName())))
+			return
+		}
+	}
+	m.Throws = append(m.Throws, t)
+}
+
+// checkErrors checks that the types thrown by methods are error types,
+// and that error codes are unique
+func (v *Visitor) checkErrors() {
+	codes := make(map[int]string)
+	for _, s := range v.pkg.Structs {
+		if code, ok := s.ErrorCode(); ok {
+			if prev, ok := codes[code]; ok {
+				msg := fmt.Sprintf("Error %s has the same code as %s: %d", s.Name, prev, code)
+				v.AddErr(posErr(s.Pos, CodeDuplicateErrorCode, msg))
+			}
+			codes[code] = s.Name
+		}
+	}
+
+	for _, iface := range v.pkg.Interfaces {
+		for _, m := range iface.Methods {
+			methodCodes := make(map[int]string)
+			for _, t := range m.Throws {
+				s := v.pkg.ResolveStruct(t)
+				if s == nil && t.Package == "" && !IsBuiltin(t.GoType) && v.pkg.FindEnum(t.GoType) == nil {
+					v.checkType(t, m.Pos)
+					continue
+				}
+				code, ok := 0, false
+				if s != nil {
+					code, ok = s.ErrorCode()
+				}
+				if !ok {
+					msg := fmt.Sprintf("%s is not an error type. Declare it with //polygen:error <code>",
+						t.QualifiedName())
+					v.AddErr(posErr(m.Pos, CodeNotAnErrorType, msg))
+					continue
+				}
+				if prev, ok := methodCodes[code]; ok {
+					msg := fmt.Sprintf("Method %s throws %s and %s with the same code: %d",
+						m.Name, prev, t.QualifiedName(), code)
+					v.AddErr(posErr(m.Pos, CodeDuplicateErrorCode, msg))
+				}
+				methodCodes[code] = t.QualifiedName()
+			}
+		}
+	}
+}
@@ -2,6 +2,8 @@ package polygenlib
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -11,11 +13,33 @@ func (g JavaGenerator) GenFiles(p *Package) []File {
 	files := make([]File, 0)
 	files = append(files, g.genRPCException(p))
 	files = append(files, g.genRPCError(p))
+	for _, t := range javaErrorTypes(p) {
+		files = append(files, g.genErrorException(p, t))
+	}
+	if p.UsesType("time") {
+		files = append(files, g.genRFC3339DateFormat(p))
+	}
+	if p.UsesType("decimal") {
+		files = append(files, g.genDecimalStringModule(p))
+	}
+	if p.Int64AsString() {
+		files = append(files, g.genInt64StringSerializer(p))
+	}
 
 	for i := 0; i < len(p.Structs); i++ {
 		files = append(files, g.genStructClass(p, p.Structs[i]))
 	}
 
+	for i := 0; i < len(p.Enums); i++ {
+		files = append(files, g.genEnum(p, p.Enums[i]))
+	}
+	for i := 0; i < len(p.Scalars); i++ {
+		files = append(files, g.genScalar(p, p.Scalars[i]))
+	}
+	if len(p.Constants) > 0 {
+		files = append(files, g.genConstants(p))
+	}
+
 	for i := 0; i < len(p.Interfaces); i++ {
 		iface := p.Interfaces[i]
 		files = append(files, g.genServiceInterface(p, iface))
@@ -25,6 +49,35 @@ func (g JavaGenerator) GenFiles(p *Package) []File {
 		files = append(files, g.genServiceTypes(p, iface))
 	}
 
+	// types from imported packages go in their own Java package
+	for _, imp := range p.AllImports() {
+		for i := 0; i < len(imp.Structs); i++ {
+			f := g.genStructClass(imp, imp.Structs[i])
+			f.Name = filepath.Join(imp.Name, f.Name)
+			files = append(files, f)
+		}
+		for i := 0; i < len(imp.Enums); i++ {
+			f := g.genEnum(imp, imp.Enums[i])
+			f.Name = filepath.Join(imp.Name, f.Name)
+			files = append(files, f)
+		}
+		for i := 0; i < len(imp.Scalars); i++ {
+			f := g.genScalar(imp, imp.Scalars[i])
+			f.Name = filepath.Join(imp.Name, f.Name)
+			files = append(files, f)
+		}
+		if len(imp.Constants) > 0 {
+			f := g.genConstants(imp)
+			f.Name = filepath.Join(imp.Name, f.Name)
+			files = append(files, f)
+		}
+		if imp.Int64AsString() {
+			f := g.genInt64StringSerializer(imp)
+			f.Name = filepath.Join(imp.Name, f.Name)
+			files = append(files, f)
+		}
+	}
+
 	return files
 }
 
@@ -34,14 +87,24 @@ func JavaFilename(s string) string {
 
 func ScalarJavaType(t string) string {
 	switch t {
-	case "int":
+	case "int", "int64":
 		return "Long"
-	case "float":
+	case "int32":
+		return "Integer"
+	case "float", "float64":
 		return "Double"
+	case "float32":
+		return "Float"
 	case "bool":
 		return "Boolean"
 	case "string":
 		return "String"
+	case "[]byte":
+		return "byte[]"
+	case "time":
+		return "java.util.Date"
+	case "decimal":
+		return "java.math.BigDecimal"
 	case "":
 		return "void"
 	}
@@ -52,11 +115,22 @@ func ScalarJavaType(t string) string {
 func JavaType(t PolyType) string {
 	if t.IsMap {
 		return fmt.Sprintf("java.util.Map<%s,%s>",
-			ScalarJavaType(t.MapKeyType), ScalarJavaType(t.GoType))
+			ScalarJavaType(t.MapKeyType), JavaType(*t.Elem))
+	} else if t.IsSet {
+		return fmt.Sprintf("java.util.Set<%s>", JavaType(*t.Elem))
 	} else if t.IsList {
-		return fmt.Sprintf("java.util.List<%s>", ScalarJavaType(t.GoType))
+		return fmt.Sprintf("java.util.List<%s>", JavaType(*t.Elem))
 	}
 
+	return javaElemType(t)
+}
+
+// javaElemType returns the Java type of the innermost element type of t.
+// Types from imported packages are qualified with their Java package.
+func javaElemType(t PolyType) string {
+	if t.Package != "" {
+		return t.Package + "." + t.GoType
+	}
 	return ScalarJavaType(t.GoType)
 }
 
@@ -65,46 +139,302 @@ func JavaName(s string) string {
 }
 
 func VarName(s string) string {
-	return strings.ToLower(s)
+	return javaIdent(strings.ToLower(s))
+}
+
+// javaReserved are the Java keywords and literals, and the final methods
+// of java.lang.Object, which generated classes can't declare
+var javaReserved = wordSet(`abstract assert boolean break byte case catch char class const
+	continue default do double else enum extends final finally float for goto if implements
+	import instanceof int interface long native new package private protected public return
+	short static strictfp super switch synchronized this throw throws transient try void
+	volatile while true false null _ getClass notify notifyAll wait`)
+
+// javaIdent returns ident, escaped if it is reserved in Java
+func javaIdent(ident string) string {
+	return escapeReserved(ident, javaReserved)
+}
+
+// javaAccessorName returns the name of the getter for the field prop
+func javaAccessorName(prop Property) string {
+	return javaIdent("get" + JavaName(prop.Name))
+}
+
+// javaLibraryClasses are the classes generated code refers to by their
+// simple names, which IDL types would hide
+var javaLibraryClasses = map[string]string{
+	"Boolean":                  "java.lang.Boolean",
+	"Double":                   "java.lang.Double",
+	"Exception":                "java.lang.Exception",
+	"Float":                    "java.lang.Float",
+	"IllegalArgumentException": "java.lang.IllegalArgumentException",
+	"Integer":                  "java.lang.Integer",
+	"Long":                     "java.lang.Long",
+	"Object":                   "java.lang.Object",
+	"Runnable":                 "java.lang.Runnable",
+	"String":                   "java.lang.String",
+	"StringBuilder":            "java.lang.StringBuilder",
+	"System":                   "java.lang.System",
+	"Thread":                   "java.lang.Thread",
+	"Throwable":                "java.lang.Throwable",
+	"Deprecated":               "java.lang.Deprecated",
+	"JsonNode":                 "org.codehaus.jackson.JsonNode",
+	"JsonProperty":             "org.codehaus.jackson.annotate.JsonProperty",
+	"JsonSubTypes":             "org.codehaus.jackson.annotate.JsonSubTypes",
+	"JsonTypeInfo":             "org.codehaus.jackson.annotate.JsonTypeInfo",
+	"ObjectMapper":             "org.codehaus.jackson.map.ObjectMapper",
+	"ObjectNode":               "org.codehaus.jackson.node.ObjectNode",
+	"SerializationConfig":      "org.codehaus.jackson.map.SerializationConfig",
+}
+
+// javaServiceClasses are the nested classes of the generated service
+// classes
+var javaServiceClasses = []string{"PolygenProvider", "PolygenHttpProvider", "Worker",
+	"BaseReqObj", "BaseParamsReqObj", "BaseRespObj"}
+
+// javaGeneratedNames returns the classes generated in the Java package of
+// pkg, other than those for its types. main is true if pkg is the package
+// being generated rather than an import.
+func javaGeneratedNames(pkg *Package, main bool) []generatedName {
+	names := make([]generatedName, 0)
+	for name, class := range javaLibraryClasses {
+		names = append(names, generatedName{name, "class " + class, declaredName{}})
+	}
+	if len(pkg.Constants) > 0 {
+		names = append(names, generatedName{"Constants", "class Constants", declaredName{}})
+	}
+	if pkg.Int64AsString() {
+		names = append(names, generatedName{"Int64StringSerializer", "class Int64StringSerializer", declaredName{}})
+	}
+	if !main {
+		return names
+	}
+
+	names = append(names, generatedName{"RPCException", "class RPCException", declaredName{}},
+		generatedName{"RPCError", "class RPCError", declaredName{}})
+	if pkg.UsesType("time") {
+		names = append(names, generatedName{"RFC3339DateFormat", "class RFC3339DateFormat", declaredName{}})
+	}
+	if pkg.UsesType("decimal") {
+		names = append(names, generatedName{"DecimalStringModule", "class DecimalStringModule", declaredName{}})
+	}
+	for _, t := range javaErrorTypes(pkg) {
+		name := javaExceptionName(t)
+		g := generatedName{name, "exception class " + name, declaredName{}}
+		if s := pkg.ResolveStruct(t); s != nil && t.Package == "" {
+			g.from = declaredName{"Error type " + s.Name, s.Name, s.Pos}
+		}
+		names = append(names, g)
+	}
+	for _, iface := range pkg.Interfaces {
+		from := declaredName{"Interface " + iface.Name, iface.Name, iface.Pos}
+		for _, suffix := range []string{"Dispatcher", "HttpServer", "Client", "Types"} {
+			name := iface.Name + suffix
+			names = append(names, generatedName{name, "class " + name, from})
+		}
+	}
+	if len(pkg.Interfaces) > 0 {
+		for _, name := range javaServiceClasses {
+			names = append(names, generatedName{name, "nested class " + name, declaredName{}})
+		}
+	}
+	return names
+}
+
+// CheckIdentifiers reports the names in p that are reserved in Java, or
+// that clash with the names of generated or library classes. Type and
+// package names can't be escaped.
+func (g JavaGenerator) CheckIdentifiers(p *Package, escape bool) error {
+	c := &reservedChecker{lang: "Java", reserved: javaReserved, escape: escape}
+	for _, pkg := range append([]*Package{p}, p.AllImports()...) {
+		c.checkPackage(pkg)
+		// class names clash on case-insensitive file systems
+		c.checkGenerated(typeNames(pkg), javaGeneratedNames(pkg, pkg == p), true)
+		for _, s := range pkg.Structs {
+			c.check(s.Pos, "Struct "+s.Name, s.Name, s.Name, false)
+			for _, prop := range s.Props {
+				// a field is reported once, for its variable or its getter
+				ident := strings.ToLower(prop.Name)
+				if !c.reserved[ident] {
+					ident = "get" + JavaName(prop.Name)
+				}
+				c.check(prop.Pos, "Field "+s.Name+"."+prop.Name, prop.Name, ident, true)
+			}
+		}
+		for _, e := range pkg.Enums {
+			c.check(e.Pos, "Enum "+e.Name, e.Name, e.Name, false)
+			for _, ev := range e.Values {
+				c.check(ev.Pos, "Enum value "+ev.Name, ev.Name, ev.Name, true)
+			}
+		}
+		for _, sc := range pkg.Scalars {
+			c.check(sc.Pos, "Type "+sc.Name, sc.Name, sc.Name, false)
+		}
+		for _, k := range pkg.Constants {
+			c.check(k.Pos, "Constant "+k.Name, k.Name, k.Name, true)
+		}
+		for _, iface := range pkg.Interfaces {
+			c.check(iface.Pos, "Interface "+iface.Name, iface.Name, iface.Name, false)
+			for _, m := range iface.Methods {
+				c.check(m.Pos, "Method "+iface.Name+"."+m.Name, m.Name, m.Name, true)
+				for _, arg := range m.Args {
+					what := "Argument " + arg.Name + " of " + iface.Name + "." + m.Name
+					c.check(arg.Pos, what, arg.Name, strings.ToLower(arg.Name), true)
+				}
+			}
+		}
+	}
+	c.checkExceptionNames(p)
+	return c.result()
 }
 
 func ServiceResponseType(t PolyType) string {
+	if t.IsList {
+		return respTypeName(t)
+	}
+	return respTypeName(t) + "TypeRespObj"
+}
+
+// respTypeName returns a Java identifier that describes t, such as
+// ListMapStringLong for []map[string]int
+func respTypeName(t PolyType) string {
 	if t.IsMap {
-		return "Map" + ScalarJavaType(t.MapKeyType) + ScalarJavaType(t.GoType) +
-			"TypeRespObj"
+		return "Map" + ScalarJavaType(t.MapKeyType) + respTypeName(*t.Elem)
+	} else if t.IsSet {
+		return "Set" + respTypeName(*t.Elem)
 	} else if t.IsList {
-		return "List" + ScalarJavaType(t.GoType)
+		return "List" + respTypeName(*t.Elem)
+	} else if t.GoType == "[]byte" {
+		return "Binary"
+	} else if t.GoType == "time" {
+		return "Time"
+	} else if t.GoType == "decimal" {
+		return "Decimal"
 	}
-	return JavaType(t) + "TypeRespObj"
+	return strings.Replace(javaElemType(t), ".", "", -1)
 }
 
-func ParamsAsList(m Method) string {
+func ParamsAsList(p *Package, m Method) string {
 	b := NewStrBuf("//")
 	b.raw("java.util.Arrays.asList(")
 	for x := 0; x < len(m.Args); x++ {
 		if x > 0 {
 			b.raw(",")
 		}
-		b.fraw("%s", VarName(m.Args[x].Name))
+		b.fraw("%s", javaParam(p, m.Args[x]))
 	}
 	b.raw(")")
 	return b.b.String()
 }
 
+// javaParam returns the Java expression for the value of arg sent by a
+// client. int64 values sent as strings are converted to a JSON tree.
+func javaParam(p *Package, arg Property) string {
+	if p.sendsInt64String(arg.Type) {
+		return "Int64StringSerializer.toTree(" + VarName(arg.Name) + ")"
+	}
+	return VarName(arg.Name)
+}
+
 func MethodSig(m Method) string {
 	ret := JavaType(m.ReturnType)
 	b := NewStrBuf("//")
-	b.fraw("public %s %s(", ret, m.Name)
+	b.fraw("public %s %s(", ret, javaIdent(m.Name))
 	for x := 0; x < len(m.Args); x++ {
 		if x > 0 {
 			b.raw(", ")
 		}
 		b.fraw("%s %s", JavaType(m.Args[x].Type), VarName(m.Args[x].Name))
 	}
-	b.raw(") throws RPCException")
+	b.raw(") throws ")
+	for _, t := range m.Throws {
+		b.fraw("%s, ", javaExceptionName(t))
+	}
+	b.raw("RPCException")
 	return b.b.String()
 }
 
+// javaExceptionName returns the name of the exception class generated
+// for the error type t. The classes for imported error types are in the
+// same Java package as those declared locally, so their names are
+// prefixed with the package name, e.g. CommonNotFoundException.
+func javaExceptionName(t PolyType) string {
+	if t.Package != "" {
+		return JavaName(t.Package) + t.GoType + "Exception"
+	}
+	return t.GoType + "Exception"
+}
+
+// checkExceptionNames reports the error types of p whose exception
+// classes have the same name, ignoring case, as that of another error type
+func (c *reservedChecker) checkExceptionNames(p *Package) {
+	seen := make(map[string]PolyType)
+	for _, t := range javaErrorTypes(p) {
+		name := javaExceptionName(t)
+		prev, ok := seen[strings.ToLower(name)]
+		if !ok {
+			seen[strings.ToLower(name)] = t
+			continue
+		}
+		// local error types come first, so prev is reported if either is
+		s := p.ResolveStruct(prev)
+		other := p.ResolveStruct(t)
+		msg := fmt.Sprintf("Error type %s clashes with %s: both generate Java exception class %s",
+			prev.QualifiedName(), t.QualifiedName(), name)
+		e := nameErr(s.Pos, CodeDuplicateName, s.Name, msg)
+		e.Related = []PolyError{nameErr(other.Pos, "", other.Name, "Error type "+t.QualifiedName()+" is declared here")}
+		c.errs = append(c.errs, e)
+	}
+}
+
+// javaErrorTypes returns the error types that exception classes are
+// generated for: the error structs declared in p, and any imported error
+// structs thrown by its methods
+func javaErrorTypes(p *Package) []PolyType {
+	types := make([]PolyType, 0)
+	for i := 0; i < len(p.Structs); i++ {
+		if _, ok := p.Structs[i].ErrorCode(); ok {
+			types = append(types, PolyType{GoType: p.Structs[i].Name})
+		}
+	}
+	for _, iface := range p.Interfaces {
+		for _, m := range iface.Methods {
+			for _, t := range m.Throws {
+				found := false
+				for _, prev := range types {
+					found = found || prev == t
+				}
+				if !found && t.Package != "" {
+					types = append(types, t)
+				}
+			}
+		}
+	}
+	return types
+}
+
+// genErrorException returns the exception class for the error type t,
+// which carries an instance of t as its data
+func (g JavaGenerator) genErrorException(p *Package, t PolyType) File {
+	s := p.ResolveStruct(t)
+	code, _ := s.ErrorCode()
+	cname := javaExceptionName(t)
+	jtype := JavaType(t)
+	b := StartFile(p)
+	b.doc("", s.Comment, deprecatedDocTags(s.Annotations)...)
+	b.f("public class %s extends RPCException {", cname)
+	b.f("    public static final int CODE = %d;", code)
+	b.f("    public %s(%s data) {", cname, jtype)
+	b.f("        this(%s, data);", quoteString(t.GoType))
+	b.w("    }")
+	b.f("    public %s(String msg, %s data) {", cname, jtype)
+	b.w("        super(CODE, msg, data);")
+	b.w("    }")
+	b.f("    public %s getData() { return (%s)super.getData(); }", jtype, jtype)
+	b.w("}")
+	return File{JavaFilename(cname), b.b.Bytes()}
+}
+
 func StartFile(p *Package) *StrBuf {
 	b := NewStrBuf("//")
 	b.prelude()
@@ -113,33 +443,354 @@ func StartFile(p *Package) *StrBuf {
 	return b
 }
 
+// javaDeprecated writes a @Deprecated annotation if a declaration with
+// the annotations a is deprecated
+func javaDeprecated(b *StrBuf, indent string, a Annotations) {
+	if a.Has("deprecated") {
+		b.f("%s@Deprecated", indent)
+	}
+}
+
 func (g JavaGenerator) genStructClass(p *Package, s Struct) File {
+	if s.IsUnion() {
+		return g.genUnionClass(p, s)
+	}
 	b := StartFile(p)
-	b.f("public class %s {", s.Name)
-	for i := 0; i < len(s.Props); i++ {
-		vname := VarName(s.Props[i].Name)
-		b.f("    private %s %s;", JavaType(s.Props[i].Type), vname)
+	b.w("import org.codehaus.jackson.annotate.JsonProperty;")
+	b.blank()
+	b.doc("", s.Comment, deprecatedDocTags(s.Annotations)...)
+	javaDeprecated(b, "", s.Annotations)
+	if u, variant := p.UnionOf(&s); u != nil {
+		b.f("@org.codehaus.jackson.annotate.JsonTypeName(%s)", quoteString(VariantName(*variant)))
+		b.f("public class %s extends %s {", s.Name, u.Name)
+	} else {
+		b.f("public class %s {", s.Name)
+	}
+	props := p.StructFields(&s)
+	for i := 0; i < len(props); i++ {
+		vname := VarName(props[i].Name)
+		if def := props[i].Constraints.Default; def != nil {
+			b.f("    private %s %s = %s;", JavaType(props[i].Type), vname, javaDefaultValue(p, props[i].Type, *def))
+		} else {
+			b.f("    private %s %s;", JavaType(props[i].Type), vname)
+		}
 	}
 	b.blank()
-	for i := 0; i < len(s.Props); i++ {
-		t := JavaType(s.Props[i].Type)
-		upper := JavaName(s.Props[i].Name)
-		vname := VarName(s.Props[i].Name)
-		b.f("    public %s get%s() { return this.%s; }", t, upper, vname)
-		b.f("    public void set%s(%s val) { this.%s = val; }", upper, t, vname)
+	for i := 0; i < len(props); i++ {
+		t := JavaType(props[i].Type)
+		getter := javaAccessorName(props[i])
+		setter := "s" + getter[1:]
+		vname := VarName(props[i].Name)
+		// Jackson would derive the property name from the accessors,
+		// which does not match the wire name of every field
+		wire := quoteString(WireName(props[i]))
+		b.doc("    ", defaultDoc(props[i]), deprecatedDocTags(props[i].Annotations)...)
+		javaDeprecated(b, "    ", props[i].Annotations)
+		b.f("    @JsonProperty(%s)", wire)
+		if p.sendsInt64String(props[i].Type) {
+			b.w("    " + javaInt64StringAnnotation)
+		}
+		b.f("    public %s %s() { return this.%s; }", t, getter, vname)
+		javaDeprecated(b, "    ", props[i].Annotations)
+		b.f("    @JsonProperty(%s)", wire)
+		b.f("    public void %s(%s val) { this.%s = val; }", setter, t, vname)
 	}
 	b.blank()
+	g.genStructValidate(p, s, b)
 	b.w("}")
 	return File{JavaFilename(s.Name), b.b.Bytes()}
 }
 
+// javaDefaultValue returns the Java expression for the default val of a
+// field of type t
+func javaDefaultValue(p *Package, t PolyType, val string) string {
+	switch t.GoType {
+	case "int", "int64":
+		return val + "L"
+	case "int32":
+		return val
+	case "float", "float64":
+		return val + "D"
+	case "float32":
+		return val + "F"
+	case "bool":
+		return val
+	case "string":
+		return quoteString(val)
+	}
+	if e := p.ResolveEnum(t); e != nil {
+		for _, ev := range e.Values {
+			if ev.Value == val {
+				return JavaType(t) + "." + javaIdent(ev.Name)
+			}
+		}
+	}
+	return "null"
+}
+
+// genUnionClass returns the abstract base class of the variants of the
+// union s. Jackson reads and writes the discriminator property to
+// select the variant's class.
+func (g JavaGenerator) genUnionClass(p *Package, s Struct) File {
+	b := StartFile(p)
+	b.w("import org.codehaus.jackson.annotate.JsonSubTypes;")
+	b.w("import org.codehaus.jackson.annotate.JsonTypeInfo;")
+	b.blank()
+	b.doc("", s.Comment, deprecatedDocTags(s.Annotations)...)
+	javaDeprecated(b, "", s.Annotations)
+	b.f("@JsonTypeInfo(use=JsonTypeInfo.Id.NAME, include=JsonTypeInfo.As.PROPERTY, property=%s)",
+		quoteString(s.Discriminator()))
+	b.w("@JsonSubTypes({")
+	for i := 0; i < len(s.Props); i++ {
+		sep := ","
+		if i == len(s.Props)-1 {
+			sep = ""
+		}
+		b.f("    @JsonSubTypes.Type(value=%s.class, name=%s)%s",
+			JavaType(s.Props[i].Type), quoteString(VariantName(s.Props[i])), sep)
+	}
+	b.w("})")
+	b.f("public abstract class %s {", s.Name)
+	b.w("    public abstract void validate(String _path);")
+	b.w("}")
+	return File{JavaFilename(s.Name), b.b.Bytes()}
+}
+
+// genStructValidate writes the validate method for s, which checks the
+// constraints declared in the IDL field tags and validates any nested
+// structs. Violations are thrown as an IllegalArgumentException, which
+// the dispatcher returns as an invalid params error.
+func (g JavaGenerator) genStructValidate(p *Package, s Struct, b *StrBuf) {
+	props := p.StructFields(&s)
+	for i := 0; i < len(props); i++ {
+		prop := props[i]
+		if prop.Constraints.Pattern != "" {
+			b.f("    private static final java.util.regex.Pattern _%sPattern =", VarName(prop.Name))
+			b.f("        java.util.regex.Pattern.compile(%s);", quoteString(prop.Constraints.Pattern))
+		}
+	}
+	b.w("    public void validate(String _path) {")
+	for i := 0; i < len(props); i++ {
+		prop := props[i]
+		c := prop.Constraints
+		val := "this." + VarName(prop.Name)
+		path := fmt.Sprintf("_path + \".%s\"", WireName(prop))
+		size := val + ".size()"
+		if prop.Type.GoType == "string" && !prop.Type.IsList && !prop.Type.IsMap {
+			size = val + ".length()"
+		}
+
+		if c.Required {
+			b.f("        if (%s == null) throw new IllegalArgumentException(%s + \" is required\");", val, path)
+		}
+		if c.Pattern != "" {
+			b.f("        if (%s != null && !_%sPattern.matcher(%s).find())", val, VarName(prop.Name), val)
+			b.f("            throw new IllegalArgumentException(%s + \" does not match pattern: \" + %s);", path, quoteString(c.Pattern))
+		}
+		if c.Min != nil {
+			min := formatFloat(*c.Min)
+			b.f("        if (%s != null && %s.doubleValue() < %s)", val, val, min)
+			b.f("            throw new IllegalArgumentException(%s + \" must be >= %s\");", path, min)
+		}
+		if c.Max != nil {
+			max := formatFloat(*c.Max)
+			b.f("        if (%s != null && %s.doubleValue() > %s)", val, val, max)
+			b.f("            throw new IllegalArgumentException(%s + \" must be <= %s\");", path, max)
+		}
+		if c.MinLength != nil {
+			b.f("        if (%s != null && %s < %d)", val, size, *c.MinLength)
+			b.f("            throw new IllegalArgumentException(%s + \" length must be >= %d\");", path, *c.MinLength)
+		}
+		if c.MaxLength != nil {
+			b.f("        if (%s != null && %s > %d)", val, size, *c.MaxLength)
+			b.f("            throw new IllegalArgumentException(%s + \" length must be <= %d\");", path, *c.MaxLength)
+		}
+		if stmt := javaValidate(p, prop.Type, val, path); stmt != "" {
+			b.f("        %s", stmt)
+		}
+	}
+	b.w("    }")
+	b.blank()
+}
+
+// javaValidate returns a Java statement that calls validate on the value
+// of the expression val, if t refers to a struct type, and checks the
+// length of fixed length arrays. path is a Java expression for the name
+// of the value used in error messages. Returns an empty string if t
+// needs neither.
+func javaValidate(p *Package, t PolyType, val string, path string) string {
+	if !javaNeedsValidate(p, t) {
+		return ""
+	}
+	return javaValidateNested(p, t, val, path, "")
+}
+
+// javaNeedsValidate returns true if t is, or contains, a struct or a
+// fixed length array
+func javaNeedsValidate(p *Package, t PolyType) bool {
+	if t.Length > 0 {
+		return true
+	} else if t.Elem != nil {
+		return javaNeedsValidate(p, *t.Elem)
+	}
+	return p.ResolveStruct(t) != nil
+}
+
+// javaValidateNested returns the statement for javaValidate. Lists and
+// maps are looped over recursively, with suffix keeping the loop
+// variables of each level distinct.
+func javaValidateNested(p *Package, t PolyType, val string, path string, suffix string) string {
+	if t.IsList {
+		stmts := make([]string, 0)
+		if t.Length > 0 {
+			stmts = append(stmts, fmt.Sprintf("if (%s.size() != %d) throw new IllegalArgumentException(%s + \" must have length %d\");",
+				val, t.Length, path, t.Length))
+		}
+		if javaNeedsValidate(p, *t.Elem) {
+			i := "_i" + suffix
+			inner := javaValidateNested(p, *t.Elem, fmt.Sprintf("%s.get(%s)", val, i),
+				fmt.Sprintf("%s + \"[\" + %s + \"]\"", path, i), suffix+"1")
+			stmts = append(stmts, fmt.Sprintf("for (int %s = 0; %s < %s.size(); %s++) { %s }", i, i, val, i, inner))
+		}
+		return fmt.Sprintf("if (%s != null) { %s }", val, strings.Join(stmts, " "))
+	} else if t.IsMap {
+		e := "_e" + suffix
+		inner := javaValidateNested(p, *t.Elem, e+".getValue()",
+			fmt.Sprintf("%s + \"[\" + %s.getKey() + \"]\"", path, e), suffix+"1")
+		return fmt.Sprintf("if (%s != null) { for (java.util.Map.Entry<String,%s> %s : %s.entrySet()) { %s } }",
+			val, JavaType(*t.Elem), e, val, inner)
+	}
+	return fmt.Sprintf("if (%s != null) %s.validate(%s);", val, val, path)
+}
+
+// formatFloat returns f formatted as a Java or JavaScript number literal
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func (g JavaGenerator) genEnum(p *Package, e Enum) File {
+	b := StartFile(p)
+	b.doc("", e.Comment, deprecatedDocTags(e.Annotations)...)
+	javaDeprecated(b, "", e.Annotations)
+	b.f("public enum %s {", e.Name)
+	for i := 0; i < len(e.Values); i++ {
+		val := e.Values[i]
+		sep := ","
+		if i == len(e.Values)-1 {
+			sep = ";"
+		}
+		b.doc("    ", val.Comment)
+		b.f("    %s(%s)%s", javaIdent(val.Name), quoteString(val.Value), sep)
+	}
+	b.blank()
+	b.w("    private final String value;")
+	b.f("    %s(String value) { this.value = value; }", e.Name)
+	b.blank()
+	b.w("    @org.codehaus.jackson.annotate.JsonValue")
+	b.w("    public String getValue() { return this.value; }")
+	b.blank()
+	b.w("    @org.codehaus.jackson.annotate.JsonCreator")
+	b.f("    public static %s fromValue(String value) {", e.Name)
+	b.f("        for (%s v : values()) {", e.Name)
+	b.w("            if (v.value.equals(value)) return v;")
+	b.w("        }")
+	b.f("        throw new IllegalArgumentException(\"Invalid %s: \" + value);", e.Name)
+	b.w("    }")
+	b.blank()
+	b.w("    public String toString() { return this.value; }")
+	b.w("}")
+	return File{JavaFilename(e.Name), b.b.Bytes()}
+}
+
+// genScalar returns the value class for the named scalar sc. It wraps a
+// value of the scalar's builtin type, which is what is sent on the wire.
+func (g JavaGenerator) genScalar(p *Package, sc Scalar) File {
+	jtype := ScalarJavaType(sc.Type.GoType)
+	b := StartFile(p)
+	b.doc("", sc.Comment, deprecatedDocTags(sc.Annotations)...)
+	javaDeprecated(b, "", sc.Annotations)
+	int64String := p.sendsInt64String(sc.Type)
+	if int64String {
+		// written by toString, rather than as the @JsonValue
+		b.w(javaInt64StringAnnotation)
+	}
+	b.f("public final class %s {", sc.Name)
+	b.f("    private final %s value;", jtype)
+	b.blank()
+	b.w("    @org.codehaus.jackson.annotate.JsonCreator")
+	b.f("    public %s(%s value) {", sc.Name, jtype)
+	b.f("        if (value == null) throw new IllegalArgumentException(\"%s may not be null\");", sc.Name)
+	b.w("        this.value = value;")
+	b.w("    }")
+	b.blank()
+	if !int64String {
+		b.w("    @org.codehaus.jackson.annotate.JsonValue")
+	}
+	b.f("    public %s getValue() { return this.value; }", jtype)
+	b.blank()
+	b.w("    public boolean equals(Object o) {")
+	b.f("        return o instanceof %s && this.value.equals(((%s)o).value);", sc.Name, sc.Name)
+	b.w("    }")
+	b.blank()
+	b.w("    public int hashCode() { return this.value.hashCode(); }")
+	b.blank()
+	b.w("    public String toString() { return String.valueOf(this.value); }")
+	b.w("}")
+	return File{JavaFilename(sc.Name), b.b.Bytes()}
+}
+
+// genConstants returns the Constants class, which holds the constants
+// declared in the IDL as static final fields
+func (g JavaGenerator) genConstants(p *Package) File {
+	b := StartFile(p)
+	b.w("public final class Constants {")
+	b.w("    private Constants() { }")
+	for i := 0; i < len(p.Constants); i++ {
+		c := p.Constants[i]
+		b.blank()
+		b.doc("    ", c.Comment)
+		b.f("    public static final %s %s = %s;", javaConstantType(c.Type), javaIdent(c.Name), javaConstantValue(c))
+	}
+	b.w("}")
+	return File{JavaFilename("Constants"), b.b.Bytes()}
+}
+
+// javaConstantType returns the primitive Java type for a constant of type t
+func javaConstantType(t PolyType) string {
+	switch t.GoType {
+	case "int":
+		return "long"
+	case "float":
+		return "double"
+	case "bool":
+		return "boolean"
+	}
+	return "String"
+}
+
+// javaConstantValue returns the Java literal for the value of c
+func javaConstantValue(c Constant) string {
+	switch c.Type.GoType {
+	case "int":
+		return c.Value + "L"
+	case "string":
+		return quoteString(c.Value)
+	}
+	return c.Value
+}
+
 func (g JavaGenerator) genServiceInterface(p *Package, iface Interface) File {
 	cname := iface.Name
 	b := StartFile(p)
+	b.doc("", iface.Comment, deprecatedDocTags(iface.Annotations)...)
+	javaDeprecated(b, "", iface.Annotations)
 	b.f("public interface %s {", cname)
 	b.blank()
 	for i := 0; i < len(iface.Methods); i++ {
-		b.f("    %s;", MethodSig(iface.Methods[i]))
+		m := iface.Methods[i]
+		b.doc("    ", m.Comment, deprecatedDocTags(m.Annotations)...)
+		javaDeprecated(b, "    ", m.Annotations)
+		b.f("    %s;", MethodSig(m))
 	}
 	b.blank()
 	b.w("}")
@@ -162,7 +813,7 @@ func (g JavaGenerator) genServiceDispatcher(p *Package, iface Interface) File {
 	b.w("    }")
 	b.blank()
 	b.w("    public String exec(String _json) {")
-	b.w("        ObjectMapper _m = new ObjectMapper();")
+	b.f("        ObjectMapper _m = %s;", javaNewMapper(p))
 	b.w("        ObjectNode _resp = _m.createObjectNode();")
 	b.w("        JsonNode _r = null;")
 	b.w("        String _id = null;")
@@ -183,38 +834,53 @@ func (g JavaGenerator) genServiceDispatcher(p *Package, iface Interface) File {
 		}
 		b.f("if (_meth.equals(\"%s_%s\")) {", iface.Name, m.Name)
 		rtype := m.ReturnType
-		jtype := JavaType(rtype)
 		params := ""
 		if len(m.Args) > 0 {
 			b.w("              JsonNode _par = _r.get(\"params\");")
 		}
 		for x := 0; x < len(m.Args); x++ {
-			prefix := "_par"
-			if len(m.Args) > 1 {
-				prefix += fmt.Sprintf(".get(%d)", x)
-			}
-			arg := m.Args[x]
+			b.f("              %s _a%d;", JavaType(m.Args[x].Type), x)
 			if x > 0 {
 				params += ","
 			}
-			argjtype := JavaType(arg.Type)
-			if arg.Type.IsMap || arg.Type.IsList {
-				params += fmt.Sprintf("(%s)_m.readValue(%s, new org.codehaus.jackson.type.TypeReference<%s>() { })", argjtype, prefix, argjtype)
-			} else if arg.Type.GoType == argjtype {
-				params += fmt.Sprintf("_m.treeToValue(%s, %s.class)", prefix, argjtype)
-			} else if argjtype == "String" {
-				params += prefix + ".asText()"
-			} else {
-				params += prefix + ".as" + argjtype + "()"
+			params += fmt.Sprintf("_a%d", x)
+		}
+		if len(m.Args) > 0 {
+			b.w("              try {")
+			for x := 0; x < len(m.Args); x++ {
+				arg := m.Args[x]
+				node := "_par"
+				if len(m.Args) > 1 {
+					node = fmt.Sprintf("_param(_par, %d)", x)
+				}
+				if arg.Type.IsOptional {
+					b.f("                _a%d = _isNull(%s) ? null : %s;", x, node,
+						javaParamValue(arg.Type, node))
+				} else {
+					node = fmt.Sprintf("_required(%s, %s)", node, quoteString(arg.Name))
+					b.f("                _a%d = %s;", x, javaParamValue(arg.Type, node))
+				}
+			}
+			for x := 0; x < len(m.Args); x++ {
+				stmt := javaValidate(p, m.Args[x].Type, fmt.Sprintf("_a%d", x), quoteString(m.Args[x].Name))
+				if stmt != "" {
+					b.f("                %s", stmt)
+				}
 			}
+			b.w("              }")
+			b.w("              catch (Exception _e) { return rpcErr(_resp, -32602, \"Invalid params: \" + _e.getMessage(), _id); }")
 		}
 		if rtype.IsVoid {
-			b.f("              _service.%s(%s);", m.Name, params)
+			b.f("              _service.%s(%s);", javaIdent(m.Name), params)
 			b.f("              _resp.put(\"result\", true);")
-		} else if rtype.GoType == jtype || rtype.IsMap || rtype.IsList {
-			b.f("              _resp.put(\"result\", _m.valueToTree(_service.%s(%s)));", m.Name, params)
+		} else if p.sendsInt64String(rtype) {
+			b.f("              _resp.put(\"result\", Int64StringSerializer.toTree(_service.%s(%s)));", javaIdent(m.Name), params)
+		} else if rtype.IsOptional {
+			b.f("              _resp.put(\"result\", _toTree(_m, _service.%s(%s)));", javaIdent(m.Name), params)
+		} else if javaIsObject(rtype) || rtype.IsMap || rtype.IsList {
+			b.f("              _resp.put(\"result\", _m.valueToTree(_service.%s(%s)));", javaIdent(m.Name), params)
 		} else {
-			b.f("              _resp.put(\"result\", _service.%s(%s));", m.Name, params)
+			b.f("              _resp.put(\"result\", _service.%s(%s));", javaIdent(m.Name), params)
 		}
 		b.w("              _resp.put(\"jsonrpc\", \"2.0\");")
 		b.w("              _resp.put(\"id\", _id);")
@@ -223,16 +889,70 @@ func (g JavaGenerator) genServiceDispatcher(p *Package, iface Interface) File {
 	}
 	b.w("            else { return rpcErr(_resp, -32601, \"Method not found: \" + _meth, _id); }")
 	b.w("          }")
-	b.w("          catch (RPCException e) { return rpcErr(_resp, e.getCode(), e.getMessage(), _id); }")
+	b.w("          catch (RPCException e) {")
+	b.w("            JsonNode _data = e.getData() == null ? null : _m.valueToTree(e.getData());")
+	b.w("            return rpcErr(_resp, e.getCode(), e.getMessage(), _data, _id);")
+	b.w("          }")
 	b.w("          catch (Throwable t) { return rpcErr(_resp, -32005, \"Unknown error: \" + t.getMessage(), _id); }")
 	b.w("        }")
 	b.w("        else { return rpcErr(_resp, -32600, \"Invalid Request. method missing: \" +_json, _id); }")
 	b.w("    }")
 	b.w(dispatcherRpcErr)
+	b.blank()
+	b.w(dispatcherHelpers)
 	b.w("}")
 	return File{JavaFilename(cname), b.b.Bytes()}
 }
 
+// javaIsObject returns true if values of type t are converted by Jackson
+// from a JSON tree, rather than read directly from a JSON scalar
+func javaIsObject(t PolyType) bool {
+	return !IsBuiltin(t.GoType) || t.GoType == "time" || t.GoType == "decimal"
+}
+
+// javaNewMapper returns a Java expression that creates the ObjectMapper
+// used by generated clients and dispatchers. If any type in p is a time,
+// the mapper is configured to read and write dates as RFC 3339 strings,
+// and if any is a decimal, to read and write BigDecimals as strings.
+func javaNewMapper(p *Package) string {
+	m := "new ObjectMapper()"
+	if p.UsesType("time") {
+		m = "RFC3339DateFormat.configure(" + m + ")"
+	}
+	if p.UsesType("decimal") {
+		m = "DecimalStringModule.configure(" + m + ")"
+	}
+	return m
+}
+
+// javaParamValue returns a Java expression that converts the JsonNode
+// expression node to the Java type for t
+func javaParamValue(t PolyType, node string) string {
+	jtype := JavaType(t)
+	if t.IsMap || t.IsList {
+		return fmt.Sprintf("(%s)_m.readValue(%s, new org.codehaus.jackson.type.TypeReference<%s>() { })", jtype, node, jtype)
+	} else if javaIsObject(t) {
+		return fmt.Sprintf("_m.treeToValue(%s, %s.class)", node, jtype)
+	} else if jtype == "String" {
+		return node + ".asText()"
+	} else if jtype == "byte[]" {
+		return node + ".getBinaryValue()"
+	}
+	return javaNodeNumber(jtype, node)
+}
+
+// javaNodeNumber returns a Java expression that reads the JsonNode
+// expression node as the boxed number or boolean type jtype
+func javaNodeNumber(jtype string, node string) string {
+	switch jtype {
+	case "Integer":
+		return node + ".asInt()"
+	case "Float":
+		return "(float)" + node + ".asDouble()"
+	}
+	return node + ".as" + jtype + "()"
+}
+
 func (g JavaGenerator) genServiceHttpServer(p *Package, iface Interface) File {
 	cname := iface.Name + "HttpServer"
 	b := StartFile(p)
@@ -266,6 +986,7 @@ func (g JavaGenerator) genServiceClient(p *Package, iface Interface) File {
 	for i := 0; i < len(iface.Methods); i++ {
 		m := iface.Methods[i]
 		mname := iface.Name + "_" + m.Name
+		javaDeprecated(b, "    ", m.Annotations)
 		b.f("    %s {", MethodSig(m))
 		if len(m.Args) == 0 {
 			b.f("        %s.BaseReqObj _rq = ", tclass)
@@ -273,20 +994,26 @@ func (g JavaGenerator) genServiceClient(p *Package, iface Interface) File {
 		} else if len(m.Args) == 1 {
 			b.f("        %s.BaseParamsReqObj _rq = ", tclass)
 			b.f("          new %s.BaseParamsReqObj(\"%s\", %s);",
-				tclass, mname, VarName(m.Args[0].Name))
+				tclass, mname, javaParam(p, m.Args[0]))
 		} else {
 			b.f("        %s.BaseParamsReqObj _rq = ", tclass)
 			b.f("          new %s.BaseParamsReqObj(\"%s\", %s);",
-				tclass, mname, ParamsAsList(m))
+				tclass, mname, ParamsAsList(p, m))
 		}
-		b.w("        ObjectMapper _m = new ObjectMapper();")
+		b.f("        ObjectMapper _m = %s;", javaNewMapper(p))
 		b.w("        try {")
 		b.w("            String _j = _prv.execRPC(_m.writeValueAsString(_rq));")
 		if m.ReturnType.IsVoid {
 			b.f("          %s.BaseRespObj _resp = ", tclass)
 			b.f("            new %s.BaseRespObj(_m, _j);", tclass)
+			genJavaClientErrors(m, b, "          ")
 			b.w("          if (_resp.getError() != null) ")
 			b.w("            throw new RPCException(_resp.getError());")
+		} else if len(m.Throws) > 0 {
+			rtype := tclass + "." + ServiceResponseType(m.ReturnType)
+			b.f("            %s _resp = new %s(_m, _j);", rtype, rtype)
+			genJavaClientErrors(m, b, "            ")
+			b.w("            return _resp.getResult();")
 		} else {
 			rtype := tclass + "." + ServiceResponseType(m.ReturnType)
 			b.f("            return new %s(_m, _j).getResult();", rtype)
@@ -301,6 +1028,20 @@ func (g JavaGenerator) genServiceClient(p *Package, iface Interface) File {
 	return File{JavaFilename(cname), b.b.Bytes()}
 }
 
+// genJavaClientErrors writes the statements that throw the typed
+// exception for an error response to m with the code of a declared error
+func genJavaClientErrors(m Method, b *StrBuf, indent string) {
+	if len(m.Throws) == 0 {
+		return
+	}
+	b.f("%sRPCError _err = _resp.getError();", indent)
+	for _, t := range m.Throws {
+		b.f("%sif (_err != null && _err.getCode() == %s.CODE)", indent, javaExceptionName(t))
+		b.f("%s    throw new %s(_err.getMessage(), _err.getData() == null ? null : _m.treeToValue(_err.getData(), %s.class));",
+			indent, javaExceptionName(t), JavaType(t))
+	}
+}
+
 func (g JavaGenerator) genServiceTypes(p *Package, iface Interface) File {
 	cname := iface.Name + "Types"
 	retTypes := make(map[string]bool)
@@ -324,16 +1065,18 @@ func (g JavaGenerator) genServiceTypes(p *Package, iface Interface) File {
 				b.f("        %s result;", jtype)
 				b.f("        public %s(ObjectMapper m, String j) throws java.io.IOException {", resptype)
 				b.w("            super(m, j);")
-				b.w("            if (root.has(\"result\"))")
+				b.w("            if (root.has(\"result\") && !root.get(\"result\").isNull())")
 				if rtype.IsList || rtype.IsMap {
 					b.f("                result = m.readValue(root.get(\"result\"), new org.codehaus.jackson.type.TypeReference<%s>() { });", jtype)
-				} else if jtype == rtype.GoType {
+				} else if javaIsObject(rtype) {
 					// custom object, not a built in java type
 					b.f("                result = m.treeToValue(root.get(\"result\"), %s.class);", jtype)
 				} else if jtype == "String" {
 					b.f("                result = root.get(\"result\").asText();")
+				} else if jtype == "byte[]" {
+					b.f("                result = root.get(\"result\").getBinaryValue();")
 				} else {
-					b.f("                result = root.get(\"result\").as%s();", jtype)
+					b.f("                result = %s;", javaNodeNumber(jtype, "root.get(\"result\")"))
 				}
 				b.w("        }")
 				b.f("        public %s getResult() throws RPCException {", jtype)
@@ -349,18 +1092,75 @@ func (g JavaGenerator) genServiceTypes(p *Package, iface Interface) File {
 	return File{JavaFilename(cname), b.b.Bytes()}
 }
 
+// javaInt64StringAnnotation is the annotation on the accessors of values
+// that contain int64 values sent as strings
+const javaInt64StringAnnotation = "@org.codehaus.jackson.map.annotate.JsonSerialize(using=Int64StringSerializer.class)"
+
+// genInt64StringSerializer returns the serializer for values that contain
+// int64 values sent as strings. Jackson reads a Long from a string, so no
+// deserializer is needed.
+func (g JavaGenerator) genInt64StringSerializer(p *Package) File {
+	b := StartFile(p)
+	b.w("import org.codehaus.jackson.JsonGenerator;")
+	b.w("import org.codehaus.jackson.JsonNode;")
+	b.w("import org.codehaus.jackson.map.JsonSerializer;")
+	b.w("import org.codehaus.jackson.map.SerializerProvider;")
+	b.w("import org.codehaus.jackson.node.ArrayNode;")
+	b.w("import org.codehaus.jackson.node.JsonNodeFactory;")
+	b.w("import org.codehaus.jackson.node.ObjectNode;")
+	b.blank()
+	b.w(int64StringSerializerBoilerplate)
+	return File{JavaFilename("Int64StringSerializer"), b.b.Bytes()}
+}
+
+// genDecimalStringModule returns the Jackson module that converts
+// BigDecimals to and from strings. Strings that are not decimal numbers,
+// and JSON numbers, are rejected when read.
+func (g JavaGenerator) genDecimalStringModule(p *Package) File {
+	b := StartFile(p)
+	b.w("import org.codehaus.jackson.JsonGenerator;")
+	b.w("import org.codehaus.jackson.JsonParser;")
+	b.w("import org.codehaus.jackson.JsonToken;")
+	b.w("import org.codehaus.jackson.Version;")
+	b.w("import org.codehaus.jackson.map.DeserializationContext;")
+	b.w("import org.codehaus.jackson.map.JsonDeserializer;")
+	b.w("import org.codehaus.jackson.map.JsonSerializer;")
+	b.w("import org.codehaus.jackson.map.ObjectMapper;")
+	b.w("import org.codehaus.jackson.map.SerializerProvider;")
+	b.w("import org.codehaus.jackson.map.module.SimpleModule;")
+	b.blank()
+	b.w(decimalStringModuleBoilerplate)
+	return File{JavaFilename("DecimalStringModule"), b.b.Bytes()}
+}
+
+// genRFC3339DateFormat returns the DateFormat used by Jackson to convert
+// dates to and from RFC 3339 strings. Dates are always written in UTC.
+func (g JavaGenerator) genRFC3339DateFormat(p *Package) File {
+	b := StartFile(p)
+	b.w("import org.codehaus.jackson.map.ObjectMapper;")
+	b.w("import org.codehaus.jackson.map.SerializationConfig;")
+	b.blank()
+	b.w(rfc3339Boilerplate)
+	return File{JavaFilename("RFC3339DateFormat"), b.b.Bytes()}
+}
+
 func (g JavaGenerator) genRPCException(p *Package) File {
 	cname := "RPCException"
 	b := StartFile(p)
 	b.f("public class %s extends Exception {", cname)
 	b.w("    private int code;")
+	b.w("    private Object data;")
 	b.w("    public RPCException(int code, String msg) {")
-	b.w("        super(msg); this.code = code;")
+	b.w("        this(code, msg, null);")
+	b.w("    }")
+	b.w("    public RPCException(int code, String msg, Object data) {")
+	b.w("        super(msg); this.code = code; this.data = data;")
 	b.w("    }")
 	b.w("    public RPCException(RPCError err) {")
-	b.w("        this(err.getCode(), err.getMessage());")
+	b.w("        this(err.getCode(), err.getMessage(), err.getData());")
 	b.w("    }")
 	b.w("    public int getCode() { return this.code; }")
+	b.w("    public Object getData() { return this.data; }")
 	b.w("}")
 	return File{JavaFilename(cname), b.b.Bytes()}
 }
@@ -371,10 +1171,13 @@ func (g JavaGenerator) genRPCError(p *Package) File {
 	b.f("public class %s {", cname)
 	b.w("    private int code;")
 	b.w("    private String message;")
+	b.w("    private org.codehaus.jackson.JsonNode data;")
 	b.w("    public int getCode() { return this.code; }")
 	b.w("    public String getMessage() { return this.message; }")
+	b.w("    public org.codehaus.jackson.JsonNode getData() { return this.data; }")
 	b.w("    public void setCode(int c) { this.code = c; }")
 	b.w("    public void setMessage(String m) { this.message = m; }")
+	b.w("    public void setData(org.codehaus.jackson.JsonNode d) { this.data = d; }")
 	b.w("}")
 	return File{JavaFilename(cname), b.b.Bytes()}
 }
@@ -616,10 +1419,150 @@ var httpServerBoilerplate = `    private java.util.List<Worker> pool;
     }`
 
 var dispatcherRpcErr = `    private String rpcErr(ObjectNode resp, int code, String msg, String id) {
+        return rpcErr(resp, code, msg, null, id);
+    }
+
+    private String rpcErr(ObjectNode resp, int code, String msg, JsonNode data, String id) {
         resp.put("jsonrpc", "2.0");
         resp.put("id", id);
         ObjectNode err = resp.putObject("error");
         err.put("code", code);
         err.put("message", msg);
+        if (data != null) {
+            err.put("data", data);
+        }
         return resp.toString();
     }`
+
+var dispatcherHelpers = `    private static boolean _isNull(JsonNode node) {
+        return node == null || node.isNull();
+    }
+
+    private static JsonNode _param(JsonNode params, int i) {
+        return (params == null) ? null : params.get(i);
+    }
+
+    private static JsonNode _required(JsonNode node, String name) {
+        if (_isNull(node)) {
+            throw new IllegalArgumentException("missing required param: " + name);
+        }
+        return node;
+    }
+
+    private static JsonNode _toTree(ObjectMapper m, Object val) {
+        if (val == null) {
+            return org.codehaus.jackson.node.NullNode.getInstance();
+        }
+        return m.valueToTree(val);
+    }`
+
+var int64StringSerializerBoilerplate = `/**
+ * Writes int64 values, and lists and maps of them, as decimal strings
+ */
+public class Int64StringSerializer extends JsonSerializer<Object> {
+    public void serialize(Object val, JsonGenerator jgen, SerializerProvider provider) throws java.io.IOException {
+        jgen.writeTree(toTree(val));
+    }
+
+    public static JsonNode toTree(Object val) {
+        JsonNodeFactory f = JsonNodeFactory.instance;
+        if (val == null) {
+            return f.nullNode();
+        } else if (val instanceof java.util.Collection) {
+            ArrayNode arr = f.arrayNode();
+            for (Object o : (java.util.Collection<?>)val) {
+                arr.add(toTree(o));
+            }
+            return arr;
+        } else if (val instanceof java.util.Map) {
+            ObjectNode obj = f.objectNode();
+            for (java.util.Map.Entry<?,?> e : ((java.util.Map<?,?>)val).entrySet()) {
+                obj.put(String.valueOf(e.getKey()), toTree(e.getValue()));
+            }
+            return obj;
+        }
+        return f.textNode(String.valueOf(val));
+    }
+}`
+
+var decimalStringModuleBoilerplate = `/**
+ * Reads and writes BigDecimal values as strings such as "-12.50", so that
+ * clients that read JSON numbers as doubles lose no precision
+ */
+public class DecimalStringModule extends SimpleModule {
+    private static final java.util.regex.Pattern PATTERN = java.util.regex.Pattern.compile("-?\\d+(\\.\\d+)?");
+
+    public DecimalStringModule() {
+        super("DecimalStringModule", new Version(1, 0, 0, null));
+        addSerializer(java.math.BigDecimal.class, new JsonSerializer<java.math.BigDecimal>() {
+            public void serialize(java.math.BigDecimal val, JsonGenerator jgen, SerializerProvider provider) throws java.io.IOException {
+                jgen.writeString(val.toPlainString());
+            }
+        });
+        addDeserializer(java.math.BigDecimal.class, new JsonDeserializer<java.math.BigDecimal>() {
+            public java.math.BigDecimal deserialize(JsonParser jp, DeserializationContext ctxt) throws java.io.IOException {
+                String s = jp.getText();
+                if (jp.getCurrentToken() != JsonToken.VALUE_STRING || !PATTERN.matcher(s).matches()) {
+                    throw ctxt.mappingException("must be a decimal string (not " + s + ")");
+                }
+                return new java.math.BigDecimal(s);
+            }
+        });
+    }
+
+    public static ObjectMapper configure(ObjectMapper m) {
+        m.registerModule(new DecimalStringModule());
+        return m;
+    }
+}`
+
+var rfc3339Boilerplate = `public class RFC3339DateFormat extends java.text.DateFormat {
+    private static final java.util.TimeZone UTC = java.util.TimeZone.getTimeZone("UTC");
+    private static final java.util.regex.Pattern PATTERN = java.util.regex.Pattern.compile(
+        "(\\d{4})-(\\d{2})-(\\d{2})[Tt ](\\d{2}):(\\d{2}):(\\d{2})(\\.\\d+)?([Zz]|[+-]\\d{2}:\\d{2})");
+
+    public RFC3339DateFormat() {
+        setCalendar(java.util.Calendar.getInstance(UTC));
+        setNumberFormat(java.text.NumberFormat.getIntegerInstance());
+    }
+
+    public static ObjectMapper configure(ObjectMapper m) {
+        m.setDateFormat(new RFC3339DateFormat());
+        m.configure(SerializationConfig.Feature.WRITE_DATES_AS_TIMESTAMPS, false);
+        return m;
+    }
+
+    public StringBuffer format(java.util.Date date, StringBuffer buf, java.text.FieldPosition pos) {
+        java.text.SimpleDateFormat f = new java.text.SimpleDateFormat("yyyy-MM-dd'T'HH:mm:ss.SSS'Z'");
+        f.setTimeZone(UTC);
+        return f.format(date, buf, pos);
+    }
+
+    public java.util.Date parse(String s, java.text.ParsePosition pos) {
+        java.util.regex.Matcher m = PATTERN.matcher(s);
+        m.region(pos.getIndex(), s.length());
+        if (!m.matches()) {
+            pos.setErrorIndex(pos.getIndex());
+            return null;
+        }
+        java.util.Calendar c = java.util.Calendar.getInstance(UTC);
+        c.clear();
+        c.set(Integer.parseInt(m.group(1)), Integer.parseInt(m.group(2)) - 1, Integer.parseInt(m.group(3)),
+              Integer.parseInt(m.group(4)), Integer.parseInt(m.group(5)), Integer.parseInt(m.group(6)));
+        long millis = c.getTimeInMillis();
+        if (m.group(7) != null) {
+            millis += Integer.parseInt((m.group(7).substring(1) + "00").substring(0, 3));
+        }
+        String tz = m.group(8);
+        if (!tz.equalsIgnoreCase("Z")) {
+            long offset = Integer.parseInt(tz.substring(1, 3)) * 60 + Integer.parseInt(tz.substring(4, 6));
+            millis -= (tz.charAt(0) == '-' ? -offset : offset) * 60000L;
+        }
+        pos.setIndex(s.length());
+        return new java.util.Date(millis);
+    }
+
+    public Object clone() {
+        return new RFC3339DateFormat();
+    }
+}`
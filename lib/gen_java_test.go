@@ -4,6 +4,8 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -61,3 +63,284 @@ func TestJavaGenerator(t *testing.T) {
 		t.Errorf("Error running command: javac %s\n%s\n%s", args, err, out)
 	}
 }
+
+func TestJavaGeneratorComments(t *testing.T) {
+	pkg, err := Parse("test.go", commentIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := JavaGenerator{}.GenFiles(pkg)
+	contents := make(map[string]string)
+	for i := 0; i < len(files); i++ {
+		contents[files[i].Name] = string(files[i].Contents)
+	}
+
+	expected := map[string]string{
+		"Person.java":        "/**\n * Person is someone\n * we know\n */\npublic class Person {",
+		"PersonService.java": "    /**\n     * Create stores p\n     */\n    public Result Create(",
+	}
+	for fname, s := range expected {
+		if !strings.Contains(contents[fname], s) {
+			t.Errorf("%s does not contain:\n%s\n\n%s", fname, s, contents[fname])
+		}
+	}
+}
+
+func TestJavaNestedTypes(t *testing.T) {
+	person := PolyType{GoType: "Person"}
+	intType := PolyType{GoType: "int"}
+	groups := PolyType{GoType: "Person", MapKeyType: "string", IsMap: true,
+		Elem: &PolyType{GoType: "Person", IsList: true, Elem: &person}}
+	counts := PolyType{GoType: "int", IsList: true,
+		Elem: &PolyType{GoType: "int", MapKeyType: "string", IsMap: true, Elem: &intType}}
+
+	if JavaType(groups) != "java.util.Map<String,java.util.List<Person>>" {
+		t.Errorf("Unexpected Java type: %s", JavaType(groups))
+	}
+	if ServiceResponseType(groups) != "MapStringListPersonTypeRespObj" {
+		t.Errorf("Unexpected response type: %s", ServiceResponseType(groups))
+	}
+	if ServiceResponseType(counts) != "ListMapStringLong" {
+		t.Errorf("Unexpected response type: %s", ServiceResponseType(counts))
+	}
+
+	set := PolyType{GoType: "int", IsList: true, IsSet: true, Elem: &intType}
+	if JavaType(set) != "java.util.Set<Long>" {
+		t.Errorf("Unexpected Java type: %s", JavaType(set))
+	}
+	if ServiceResponseType(set) != "SetLong" {
+		t.Errorf("Unexpected response type: %s", ServiceResponseType(set))
+	}
+}
+
+// assertJavaFilesContain checks that the Java generated for pkg includes
+// each file in expected, and that the file contains the expected text
+func assertJavaFilesContain(t *testing.T, pkg *Package, expected map[string]string) {
+	for _, f := range (JavaGenerator{}).GenFiles(pkg) {
+		if s, ok := expected[f.Name]; ok {
+			delete(expected, f.Name)
+			if !strings.Contains(string(f.Contents), s) {
+				t.Errorf("%s does not contain %q:\n%s", f.Name, s, f.Contents)
+			}
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("Files not generated: %v", expected)
+	}
+}
+
+func TestJavaGeneratorScalars(t *testing.T) {
+	idl := "package foo\n\n//polygen:deprecated\ntype Cents int\n\ntype Svc interface {\n Balance(user string) Cents\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Cents.java": "@Deprecated\npublic final class Cents {\n    private final Long value;",
+		"Svc.java":   "public Cents Balance(String user) throws RPCException;",
+	}
+	assertJavaFilesContain(t, pkg, expected)
+}
+
+func TestJavaGeneratorInt64String(t *testing.T) {
+	idl := "//polygen:int64 string\npackage foo\n\ntype Sample struct {\n Id int64\n Small int32\n Ratio float32\n}\n\ntype Svc interface {\n Ids() []int64\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Sample.java":                "    " + javaInt64StringAnnotation + "\n    public Long getId()",
+		"SvcDispatcher.java":         "Int64StringSerializer.toTree(",
+		"Int64StringSerializer.java": "public class Int64StringSerializer",
+	}
+	assertJavaFilesContain(t, pkg, expected)
+	assertJavaFilesContain(t, pkg, map[string]string{"Sample.java": "public Integer getSmall()"})
+}
+
+func TestJavaGeneratorArrays(t *testing.T) {
+	idl := "package foo\n\ntype Point struct {\n Coords [3]float\n}\n\ntype Svc interface {\n Move(p Point, by [3]float)\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Point.java":         `if (this.coords != null) { if (this.coords.size() != 3) throw new IllegalArgumentException(_path + ".coords" + " must have length 3"); }`,
+		"SvcDispatcher.java": `if (_a1 != null) { if (_a1.size() != 3) throw new IllegalArgumentException("by" + " must have length 3"); }`,
+	}
+	assertJavaFilesContain(t, pkg, expected)
+}
+
+func TestJavaGeneratorTime(t *testing.T) {
+	idl := "package foo\n\ntype Svc interface {\n Now() time\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range (JavaGenerator{}).GenFiles(pkg) {
+		if f.Name == "RFC3339DateFormat.java" {
+			found = true
+		} else if f.Name == "SvcDispatcher.java" &&
+			!strings.Contains(string(f.Contents), "RFC3339DateFormat.configure(new ObjectMapper())") {
+			t.Errorf("Dispatcher does not use RFC3339DateFormat")
+		}
+	}
+	if !found {
+		t.Errorf("RFC3339DateFormat.java not generated")
+	}
+}
+
+func TestJavaGeneratorDecimal(t *testing.T) {
+	idl := "package foo\n\nimport \"time\"\n\ntype Svc interface {\n Total(at time.Time, prices []decimal) decimal\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"DecimalStringModule.java": "jgen.writeString(val.toPlainString());",
+		"SvcDispatcher.java":       "DecimalStringModule.configure(RFC3339DateFormat.configure(new ObjectMapper()))",
+		"SvcTypes.java":            "result = m.treeToValue(root.get(\"result\"), java.math.BigDecimal.class);",
+		"Svc.java":                 "public java.math.BigDecimal Total(java.util.Date at, java.util.List<java.math.BigDecimal> prices)",
+	}
+	assertJavaFilesContain(t, pkg, expected)
+}
+
+func TestJavaGeneratorErrors(t *testing.T) {
+	idl := "package foo\n\n//polygen:error 404\ntype NotFound struct {\n Id int\n}\n\n" +
+		"type Svc interface {\n Get(id int) (string, NotFound)\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range (JavaGenerator{}).GenFiles(pkg) {
+		if f.Name == "NotFoundException.java" {
+			found = true
+		} else if f.Name == "Svc.java" &&
+			!strings.Contains(string(f.Contents), "throws NotFoundException, RPCException") {
+			t.Errorf("Svc.Get does not throw NotFoundException")
+		}
+	}
+	if !found {
+		t.Errorf("NotFoundException.java not generated")
+	}
+}
+
+func TestJavaImportedErrors(t *testing.T) {
+	root, err := ioutil.TempDir("", "polygen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeIdlDir(t, filepath.Join(root, "common"), map[string]string{
+		"common.go": "package common\n\n//polygen:error 404\ntype NotFound struct {\n Id int\n}",
+	})
+	writeIdlDir(t, filepath.Join(root, "app"), map[string]string{
+		"app.go": "package app\n\nimport \"../common\"\n\n//polygen:error 410\ntype NotFound struct {\n Id int\n}\n\n" +
+			"type Svc interface {\n //polygen:throws NotFound, common.NotFound\n Get(id int) string\n}",
+	})
+	pkg, err := ParseDir(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"NotFoundException.java":       "public class NotFoundException extends RPCException",
+		"CommonNotFoundException.java": "public class CommonNotFoundException extends RPCException",
+		"Svc.java":                     "throws NotFoundException, CommonNotFoundException, RPCException",
+	}
+	assertJavaFilesContain(t, pkg, expected)
+	if err := (JavaGenerator{}).CheckIdentifiers(pkg, false); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	writeIdlDir(t, filepath.Join(root, "clash"), map[string]string{
+		"clash.go": "package clash\n\nimport \"../common\"\n\n//polygen:error 410\ntype CommonNotFound struct {\n Id int\n}\n\n" +
+			"type Svc interface {\n //polygen:throws CommonNotFound, common.NotFound\n Get(id int) string\n}",
+	})
+	pkg, err = ParseDir(filepath.Join(root, "clash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (JavaGenerator{}).CheckIdentifiers(pkg, false)
+	msg := "Error type CommonNotFound clashes with common.NotFound: both generate Java exception class CommonNotFoundException"
+	if err == nil || !strings.Contains(err.Error(), msg) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestJavaGeneratorUnion(t *testing.T) {
+	idl := "package foo\n\ntype Card struct {\n Number string\n}\n\n" +
+		"//polygen:union\ntype Payment struct {\n Card Card\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range (JavaGenerator{}).GenFiles(pkg) {
+		contents := string(f.Contents)
+		if f.Name == "Payment.java" && !strings.Contains(contents, "@JsonSubTypes.Type(value=Card.class, name=\"card\")") {
+			t.Errorf("Payment.java does not list subtypes:\n%s", contents)
+		} else if f.Name == "Card.java" && !strings.Contains(contents, "public class Card extends Payment {") {
+			t.Errorf("Card does not extend Payment:\n%s", contents)
+		}
+	}
+}
+
+func TestJavaCheckGeneratedNames(t *testing.T) {
+	idl := "package foo\n\ntype SvcClient struct {\n A int\n}\n\ntype Thread struct {\n B int\n}\n\n" +
+		"type Svc interface {\n Get(t Thread) SvcClient\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (JavaGenerator{}).CheckIdentifiers(pkg, true)
+	expected := "test.go:3: Struct SvcClient clashes with Java class SvcClient\n" +
+		"test.go:7: Struct Thread clashes with Java class java.lang.Thread"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Unexpected errors: %v", err)
+	}
+	related := Diagnostics(err)[0].Related
+	if len(related) != 1 || related[0].Line != 11 || related[0].Message != "SvcClient is generated for interface Svc" {
+		t.Errorf("Unexpected related errors: %+v", related)
+	}
+}
+
+func TestJavaCheckIdentifiers(t *testing.T) {
+	idl := "package foo\n\ntype Thing struct {\n Class string\n Package int\n}\n\n" +
+		"type Svc interface {\n Get(new string) Thing\n}\n\ntype class struct {\n Name string\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"test.go:4: Field Thing.Class is generated as class, which is reserved in Java (enable escaping to generate class_)",
+		"test.go:5: Field Thing.Package is generated as package, which is reserved in Java (enable escaping to generate package_)",
+		"test.go:12: Struct class is reserved in Java",
+		"test.go:9: Argument new of Svc.Get is reserved in Java (enable escaping to generate new_)",
+	}
+	err = (JavaGenerator{}).CheckIdentifiers(pkg, false)
+	if err == nil || err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected errors: %v", err)
+	}
+	errs := Diagnostics(err)
+	if errs[0].Code != CodeReservedWord || errs[0].Column != 2 || errs[0].EndColumn != 7 {
+		t.Errorf("Unexpected error: %+v", errs[0])
+	}
+
+	err = (JavaGenerator{}).CheckIdentifiers(pkg, true)
+	if err == nil || err.Error() != expected[2] {
+		t.Errorf("Unexpected errors with escaping: %v", err)
+	}
+
+	for _, f := range (JavaGenerator{}).GenFiles(pkg) {
+		contents := string(f.Contents)
+		if f.Name == "Thing.java" && (!strings.Contains(contents, "private String class_;") ||
+			!strings.Contains(contents, "@JsonProperty(\"class\")\n    public String getClass_()") ||
+			!strings.Contains(contents, "public Long getPackage() { return this.package_; }")) {
+			t.Errorf("Thing.java does not escape fields:\n%s", contents)
+		} else if f.Name == "Svc.java" && !strings.Contains(contents, "Get(String new_)") {
+			t.Errorf("Svc.java does not escape arguments:\n%s", contents)
+		}
+	}
+}
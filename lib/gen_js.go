@@ -2,6 +2,7 @@ package polygenlib
 
 import (
 	"fmt"
+	"strings"
 )
 
 func StartJsFile(p *Package) *StrBuf {
@@ -14,29 +15,487 @@ func JsFilename(pkg string) string {
 	return pkg + ".js"
 }
 
+// JsType returns the JSDoc type expression for t, a type used in p
+func JsType(p *Package, t PolyType) string {
+	if t.IsMap {
+		return fmt.Sprintf("Object.<string, %s>", JsType(p, *t.Elem))
+	} else if t.IsList {
+		return fmt.Sprintf("Array.<%s>", JsType(p, *t.Elem))
+	}
+
+	switch t.GoType {
+	case "[]byte":
+		return "Uint8Array"
+	case "time":
+		return "Date"
+	case "int", "int32", "float", "float32", "float64":
+		return "number"
+	case "int64":
+		if p.Int64AsString() {
+			return "bigint"
+		}
+		return "number"
+	case "bool":
+		return "boolean"
+	case "string", "decimal":
+		return "string"
+	}
+	return t.QualifiedName()
+}
+
+// jsDocName returns the name of prop as used in a JSDoc @param or
+// @property tag. Optional properties are wrapped in brackets, and
+// properties with a default are written as [name=default].
+func jsDocName(prop Property) string {
+	if prop.Constraints.Default != nil {
+		return "[" + prop.Name + "=" + jsDefaultValue(prop) + "]"
+	} else if prop.Type.IsOptional {
+		return "[" + prop.Name + "]"
+	}
+	return prop.Name
+}
+
+// jsReserved are the JavaScript keywords, literals and strict mode
+// reserved words, which may not be used as variable names
+var jsReserved = wordSet(`break case catch class const continue debugger default delete do
+	else enum export extends finally for function if import in instanceof new return super
+	switch this throw try typeof var void while with implements interface let package private
+	protected public static yield await null true false eval arguments`)
+
+// jsIdent returns ident, escaped if it is reserved in JavaScript
+func jsIdent(ident string) string {
+	return escapeReserved(ident, jsReserved)
+}
+
+// jsBrowserMembers are the helpers declared on the package object of the
+// browser file, beside the package's enums, constants, unions and clients
+var jsBrowserMembers = []string{"post", "S4", "uuid", "rpcCall", "toWire", "fromWire",
+	"withDefaults", "convert", "typedError", "encodeBase64", "decodeBase64", "_types"}
+
+// jsExportedNames returns the names of the enums, constants and unions of
+// p, which are declared on the package object or exported by module. The
+// interfaces are also included if withInterfaces is true.
+func jsExportedNames(p *Package, withInterfaces bool) []declaredName {
+	names := make([]declaredName, 0)
+	for _, e := range p.Enums {
+		names = append(names, declaredName{"Enum " + e.Name, e.Name, e.Pos})
+	}
+	for _, k := range p.Constants {
+		names = append(names, declaredName{"Constant " + k.Name, k.Name, k.Pos})
+	}
+	for _, s := range p.Structs {
+		if s.IsUnion() {
+			names = append(names, declaredName{"Union " + s.Name, s.Name, s.Pos})
+		}
+	}
+	if withInterfaces {
+		for _, iface := range p.Interfaces {
+			names = append(names, declaredName{"Interface " + iface.Name, iface.Name, iface.Pos})
+		}
+	}
+	return names
+}
+
+// checkJsIdentifiers reports the names in p that are reserved in
+// JavaScript, or that clash with the generated names in generated. Only
+// package and method argument names are used as variable names; other
+// names are only used as object properties.
+func checkJsIdentifiers(p *Package, escape bool, names []declaredName, generated []generatedName) error {
+	c := &reservedChecker{lang: "JavaScript", reserved: jsReserved, escape: escape}
+	c.checkGenerated(names, generated, false)
+	for _, pkg := range append([]*Package{p}, p.AllImports()...) {
+		c.checkPackage(pkg)
+		for _, iface := range pkg.Interfaces {
+			for _, m := range iface.Methods {
+				for _, arg := range m.Args {
+					what := "Argument " + arg.Name + " of " + iface.Name + "." + m.Name
+					c.check(arg.Pos, what, arg.Name, arg.Name, true)
+				}
+			}
+		}
+	}
+	return c.result()
+}
+
+// jsDefaultValue returns the JavaScript literal for the default of prop
+func jsDefaultValue(prop Property) string {
+	val := *prop.Constraints.Default
+	if isInteger(prop.Type.GoType) || isFloat(prop.Type.GoType) || prop.Type.GoType == "bool" {
+		return val
+	}
+	return quoteString(val)
+}
+
+// GenJsTypedefs writes a JSDoc @typedef for each named scalar and struct
+// in the package
+func GenJsTypedefs(p *Package, b *StrBuf) {
+	for i := 0; i < len(p.Scalars); i++ {
+		sc := p.Scalars[i]
+		b.blank()
+		tags := append(deprecatedDocTags(sc.Annotations), fmt.Sprintf("@typedef {%s} %s", JsType(p, sc.Type), sc.Name))
+		b.doc("", sc.Comment, tags...)
+	}
+	for i := 0; i < len(p.Structs); i++ {
+		s := p.Structs[i]
+		tags := deprecatedDocTags(s.Annotations)
+		if s.IsUnion() {
+			variants := make([]string, 0)
+			for _, prop := range s.Props {
+				variants = append(variants, JsType(p, prop.Type))
+			}
+			tags = append(tags, fmt.Sprintf("@typedef {(%s)} %s", strings.Join(variants, "|"), s.Name))
+			b.blank()
+			b.doc("", s.Comment, tags...)
+			continue
+		}
+		tags = append(tags, fmt.Sprintf("@typedef {Object} %s", s.Name))
+		for _, prop := range p.StructFields(&s) {
+			// values are plain objects with the properties sent on the wire
+			prop.Name = WireName(prop)
+			tag := fmt.Sprintf("@property {%s} %s", JsType(p, prop.Type), jsDocName(prop))
+			desc := strings.Replace(prop.Comment, "\n", " ", -1)
+			if prop.Annotations.Has("deprecated") {
+				desc = strings.TrimSpace(desc + " Deprecated. " + prop.Annotations["deprecated"])
+			}
+			if desc != "" {
+				tag += " - " + desc
+			}
+			tags = append(tags, tag)
+		}
+		b.blank()
+		b.doc("", s.Comment, tags...)
+	}
+}
+
+// genJsMethodDoc writes the JSDoc block for a generated client method
+func genJsMethodDoc(p *Package, m Method, b *StrBuf) {
+	tags := make([]string, 0)
+	for y := 0; y < len(m.Args); y++ {
+		arg := m.Args[y]
+		arg.Name = jsIdent(arg.Name)
+		tags = append(tags, fmt.Sprintf("@param {%s} %s", JsType(p, arg.Type), jsDocName(arg)))
+	}
+	if m.ReturnType.IsVoid {
+		tags = append(tags, "@param {function()} _onSuccess")
+	} else if m.ReturnType.IsOptional {
+		tags = append(tags, fmt.Sprintf("@param {function(?%s)} _onSuccess",
+			JsType(p, m.ReturnType)))
+	} else {
+		tags = append(tags, fmt.Sprintf("@param {function(%s)} _onSuccess",
+			JsType(p, m.ReturnType)))
+	}
+	tags = append(tags, "@param {function(Object)} _onError")
+	tags = append(tags, deprecatedDocTags(m.Annotations)...)
+	b.doc("        ", m.Comment, tags...)
+}
+
+// GenJsEnums writes each enum in the package as a frozen object that maps
+// the value names to their wire values. decl is a format string for the
+// start of the declaration given the enum name, and end is written after
+// the closing brace.
+func GenJsEnums(p *Package, b *StrBuf, indent string, decl string, end string) {
+	for i := 0; i < len(p.Enums); i++ {
+		e := p.Enums[i]
+		b.blank()
+		b.doc(indent, e.Comment, append(deprecatedDocTags(e.Annotations), "@enum {string}")...)
+		b.f("%s%sObject.freeze({", indent, fmt.Sprintf(decl, e.Name))
+		for x := 0; x < len(e.Values); x++ {
+			val := e.Values[x]
+			sep := ","
+			if x == len(e.Values)-1 {
+				sep = ""
+			}
+			b.doc(indent+"    ", val.Comment)
+			b.f("%s    %s : %s%s", indent, val.Name, quoteString(val.Value), sep)
+		}
+		b.f("%s})%s", indent, end)
+	}
+}
+
+// GenJsConstants writes each constant in the package. decl and end are
+// used as in GenJsEnums.
+func GenJsConstants(p *Package, b *StrBuf, indent string, decl string, end string) {
+	for i := 0; i < len(p.Constants); i++ {
+		c := p.Constants[i]
+		val := c.Value
+		if c.Type.GoType == "string" {
+			val = quoteString(val)
+		}
+		b.blank()
+		b.doc(indent, c.Comment, fmt.Sprintf("@const {%s}", JsType(p, c.Type)))
+		b.f("%s%s%s%s", indent, fmt.Sprintf(decl, c.Name), val, end)
+	}
+}
+
+// GenJsUnions writes an object for each union in the package holding a
+// type guard function for each variant, e.g. Payment.isCard(p). decl and
+// end are used as in GenJsEnums.
+func GenJsUnions(p *Package, b *StrBuf, indent string, decl string, end string) {
+	for i := 0; i < len(p.Structs); i++ {
+		s := p.Structs[i]
+		if !s.IsUnion() {
+			continue
+		}
+		b.blank()
+		b.doc(indent, "Type guards for the variants of "+s.Name)
+		b.f("%s%sObject.freeze({", indent, fmt.Sprintf(decl, s.Name))
+		for x := 0; x < len(s.Props); x++ {
+			prop := s.Props[x]
+			sep := ","
+			if x == len(s.Props)-1 {
+				sep = ""
+			}
+			b.doc(indent+"    ", "", fmt.Sprintf("@param {%s} v", s.Name),
+				fmt.Sprintf("@return {boolean} true if v is a %s", JsType(p, prop.Type)))
+			b.f("%s    is%s : function(v) { return !!v && v[%s] === %s; }%s", indent, prop.Name,
+				quoteString(s.Discriminator()), quoteString(VariantName(prop)), sep)
+		}
+		b.f("%s})%s", indent, end)
+	}
+}
+
+// jsTypeName returns the name that t is registered under in the _types
+// object. Types declared in the IDL are qualified with their package name.
+func jsTypeName(p *Package, t PolyType) string {
+	if p.sendsInt64String(t) {
+		return "int64:string"
+	} else if IsBuiltin(t.GoType) {
+		return t.GoType
+	} else if t.Package != "" {
+		return t.QualifiedName()
+	}
+	return p.Name + "." + t.GoType
+}
+
+// jsTypeDesc returns the type descriptor used by the generated node
+// dispatcher to check values of type t. Sets are lists marked as "set",
+// and fixed length arrays have a "length". Named scalars are described by
+// their builtin type.
+func jsTypeDesc(p *Package, t PolyType) string {
+	if t.IsMap {
+		return fmt.Sprintf("{ \"map\" : %s }", jsTypeDesc(p, *t.Elem))
+	} else if t.IsSet {
+		return fmt.Sprintf("{ \"list\" : %s, \"set\" : true }", jsTypeDesc(p, *t.Elem))
+	} else if t.Length > 0 {
+		return fmt.Sprintf("{ \"list\" : %s, \"length\" : %d }", jsTypeDesc(p, *t.Elem), t.Length)
+	} else if t.IsList {
+		return fmt.Sprintf("{ \"list\" : %s }", jsTypeDesc(p, *t.Elem))
+	} else if sc := p.ResolveScalar(t); sc != nil {
+		return jsTypeDesc(p.TypePackage(t), sc.Type)
+	}
+	return quoteString(jsTypeName(p, t))
+}
+
+// jsFieldDesc returns the descriptor for a struct field, including any
+// constraints declared in its tag
+func jsFieldDesc(p *Package, prop Property) string {
+	desc := fmt.Sprintf("{ \"name\" : %s, \"type\" : %s",
+		quoteString(WireName(prop)), jsTypeDesc(p, prop.Type))
+	c := prop.Constraints
+	if c.Required {
+		desc += ", \"required\" : true"
+	}
+	if c.Default != nil {
+		desc += ", \"default\" : " + jsDefaultValue(prop)
+	}
+	if c.Pattern != "" {
+		desc += ", \"pattern\" : " + quoteString(c.Pattern)
+	}
+	if c.Min != nil {
+		desc += ", \"min\" : " + formatFloat(*c.Min)
+	}
+	if c.Max != nil {
+		desc += ", \"max\" : " + formatFloat(*c.Max)
+	}
+	if c.MinLength != nil {
+		desc += fmt.Sprintf(", \"minLength\" : %d", *c.MinLength)
+	}
+	if c.MaxLength != nil {
+		desc += fmt.Sprintf(", \"maxLength\" : %d", *c.MaxLength)
+	}
+	return desc + " }"
+}
+
+// GenJsTypeDescs assigns decl the object that describes the enums and
+// structs of the package, keyed by qualified name. The types of the
+// packages p imports are merged into it from the objects named by
+// importDecl, which is given each imported package's name.
+func GenJsTypeDescs(p *Package, b *StrBuf, decl string, importDecl func(pkg string) string) {
+	b.f("%s = {", decl)
+	sep := ""
+	for i := 0; i < len(p.Enums); i++ {
+		e := p.Enums[i]
+		vals := ""
+		for x := 0; x < len(e.Values); x++ {
+			if x > 0 {
+				vals += ", "
+			}
+			vals += quoteString(e.Values[x].Value)
+		}
+		b.raw(sep)
+		b.fraw("    %s : { \"enum\" : [ %s ] }", quoteString(p.Name+"."+e.Name), vals)
+		sep = ",\n"
+	}
+	for i := 0; i < len(p.Structs); i++ {
+		s := p.Structs[i]
+		b.raw(sep)
+		sep = ",\n"
+		if s.IsUnion() {
+			variants := make([]string, 0)
+			for _, prop := range s.Props {
+				variants = append(variants, fmt.Sprintf("%s : %s",
+					quoteString(VariantName(prop)), jsTypeDesc(p, prop.Type)))
+			}
+			b.fraw("    %s : { \"union\" : %s, \"variants\" : { %s } }", quoteString(p.Name+"."+s.Name),
+				quoteString(s.Discriminator()), strings.Join(variants, ", "))
+			continue
+		}
+		if code, ok := s.ErrorCode(); ok {
+			b.f("    %s : { \"error\" : %d, \"fields\" : [", quoteString(p.Name+"."+s.Name), code)
+		} else {
+			b.f("    %s : { \"fields\" : [", quoteString(p.Name+"."+s.Name))
+		}
+		props := p.StructFields(&s)
+		for x := 0; x < len(props); x++ {
+			prop := props[x]
+			comma := ","
+			if x == len(props)-1 {
+				comma = ""
+			}
+			b.f("        %s%s", jsFieldDesc(p, prop), comma)
+		}
+		b.raw("    ] }")
+	}
+	if sep != "" {
+		b.blank()
+	}
+	b.w("};")
+	if len(p.Imports) > 0 {
+		sources := make([]string, 0)
+		for _, imp := range p.Imports {
+			sources = append(sources, importDecl(imp.Pkg.Name))
+		}
+		b.f("[ %s ].forEach(function(types) {", strings.Join(sources, ", "))
+		b.f("    Object.keys(types).forEach(function(name) { %s[name] = types[name]; });",
+			strings.TrimPrefix(decl, "var "))
+		b.w("});")
+	}
+}
+
+// genNodeTypes writes the parts of a node module that describe the types
+// of p: typedefs, enums and the _types object. Imported packages are
+// loaded from their own modules.
+func genNodeTypes(p *Package, b *StrBuf) {
+	if len(p.Imports) > 0 {
+		b.blank()
+		b.w("var _imports = {")
+		for i := 0; i < len(p.Imports); i++ {
+			comma := ","
+			if i == len(p.Imports)-1 {
+				comma = ""
+			}
+			imp := p.Imports[i].Pkg
+			b.f("    %s : require('./%s')%s", quoteString(imp.Name), JsFilename(imp.Name+"-node"), comma)
+		}
+		b.w("};")
+	}
+	GenJsTypedefs(p, b)
+	GenJsEnums(p, b, "", "exports.%s = ", ";")
+	GenJsConstants(p, b, "", "exports.%s = ", ";")
+	GenJsUnions(p, b, "", "exports.%s = ", ";")
+	b.blank()
+	GenJsTypeDescs(p, b, "var _types", func(pkg string) string {
+		return "_imports." + pkg + "._types"
+	})
+	b.w("exports._types = _types;")
+}
+
+// genJsBrowserTypes writes the _types object of p as a property of the
+// package's browser global
+func genJsBrowserTypes(p *Package, b *StrBuf) {
+	GenJsTypeDescs(p, b, p.Name+"._types", func(pkg string) string {
+		return pkg + "._types"
+	})
+}
+
+// genJsImportFiles returns the browser and node modules for each package
+// imported by p. These hold the package's types, but no services.
+func genJsImportFiles(p *Package, node bool) []File {
+	files := make([]File, 0)
+	for _, imp := range p.AllImports() {
+		b := StartJsFile(imp)
+		if node {
+			genNodeTypes(imp, b)
+			files = append(files, File{JsFilename(imp.Name + "-node"), b.b.Bytes()})
+		} else {
+			GenJsTypedefs(imp, b)
+			b.blank()
+			b.f("var %s = {};", imp.Name)
+			GenJsEnums(imp, b, "", imp.Name+".%s = ", ";")
+			GenJsConstants(imp, b, "", imp.Name+".%s = ", ";")
+			GenJsUnions(imp, b, "", imp.Name+".%s = ", ";")
+			b.blank()
+			genJsBrowserTypes(imp, b)
+			files = append(files, File{JsFilename(imp.Name), b.b.Bytes()})
+		}
+	}
+	return files
+}
+
 type JsGenerator struct{}
 
+func (g JsGenerator) CheckIdentifiers(p *Package, escape bool) error {
+	generated := make([]generatedName, 0)
+	for _, name := range jsBrowserMembers {
+		generated = append(generated, generatedName{name, "helper " + p.Name + "." + name, declaredName{}})
+	}
+	return checkJsIdentifiers(p, escape, jsExportedNames(p, true), generated)
+}
+
 func (g JsGenerator) GenFiles(p *Package) []File {
 	b := StartJsFile(p)
+	GenJsTypedefs(p, b)
+	b.blank()
 
 	b.f("var %s = {", p.Name)
 	b.w(jsPostBoilerplate)
 	b.w(jsBoilerplate)
+	GenJsEnums(p, b, "", " ,  %s : ", "")
+	GenJsConstants(p, b, "", " ,  %s : ", "")
+	GenJsUnions(p, b, "", " ,  %s : ", "")
 
 	for i := 0; i < len(p.Interfaces); i++ {
 		iface := p.Interfaces[i]
 		b.blank()
+		b.doc("    ", iface.Comment, deprecatedDocTags(iface.Annotations)...)
 		b.f(" ,  %s : function(_url) {", iface.Name)
-		GenJsClientFunc(iface, b, p.Name)
+		GenJsClientFunc(p, iface, b, p.Name, p.Name+"._types")
 		b.w("    }")
 	}
 	b.w("};")
+	b.blank()
+	genJsBrowserTypes(p, b)
 	file := File{JsFilename(p.Name), b.b.Bytes()}
-	return []File{file}
+	return append([]File{file}, genJsImportFiles(p, false)...)
 }
 
 type NodeJsGenerator struct{}
 
+func (g NodeJsGenerator) CheckIdentifiers(p *Package, escape bool) error {
+	generated := []generatedName{
+		generatedName{"ReadServerRequest", "export ReadServerRequest", declaredName{}},
+		generatedName{"_types", "export _types", declaredName{}},
+	}
+	for _, iface := range p.Interfaces {
+		from := declaredName{"Interface " + iface.Name, iface.Name, iface.Pos}
+		for _, name := range []string{"Dispatch" + iface.Name, iface.Name + "Client",
+			iface.Name + "HttpServer", iface.Name + "HttpsServer"} {
+			generated = append(generated, generatedName{name, "export " + name, from})
+		}
+	}
+	return checkJsIdentifiers(p, escape, jsExportedNames(p, false), generated)
+}
+
 func (g NodeJsGenerator) GenFiles(p *Package) []File {
 	b := StartJsFile(p)
 	b.w("var _http   = require('http');")
@@ -49,6 +508,9 @@ func (g NodeJsGenerator) GenFiles(p *Package) []File {
 	b.w("};")
 	b.blank()
 	b.w(nodeReadRequestBoilerplate)
+	genNodeTypes(p, b)
+	b.blank()
+	b.w(nodeOptionalBoilerplate)
 
 	for i := 0; i < len(p.Interfaces); i++ {
 		iface := p.Interfaces[i]
@@ -57,6 +519,7 @@ func (g NodeJsGenerator) GenFiles(p *Package) []File {
 		b.f("exports.Dispatch%s = function(rpcreq, svc, onSuccess, onError) {", iface.Name)
 		b.w("    var method = rpcreq.method;")
 		b.w("    var params = rpcreq.params;")
+		b.w("    var _err = null;")
 		for x := 0; x < len(iface.Methods); x++ {
 			m := iface.Methods[x]
 			if x > 0 {
@@ -67,16 +530,48 @@ func (g NodeJsGenerator) GenFiles(p *Package) []File {
 
 			b.f("if (method === \"%s_%s\") {", iface.Name, m.Name)
 
-			if len(m.Args) == 0 {
-				b.f("        svc.%s(onSuccess, onError);", m.Name)
-			} else if len(m.Args) == 1 {
-				b.f("        svc.%s(params, onSuccess, onError);", m.Name)
-			} else {
-				plist := ""
-				for y := 0; y < len(m.Args); y++ {
-					plist += fmt.Sprintf("params[%d], ", y)
+			args := make([]string, 0)
+			checks := make([]string, 0)
+			for y := 0; y < len(m.Args); y++ {
+				arg := "params"
+				if len(m.Args) > 1 {
+					arg = fmt.Sprintf("params[%d]", y)
 				}
-				b.f("        svc.%s(%sonSuccess, onError);", m.Name, plist)
+				args = append(args, jsFromWire(p, m.Args[y].Type, "_util", "_types", arg))
+				if !m.Args[y].Type.IsOptional {
+					checks = append(checks, fmt.Sprintf("_util.required(%s, %s)",
+						arg, quoteString(m.Args[y].Name)))
+				}
+				checks = append(checks, fmt.Sprintf("_util.check(_types, %s, %s, %s)",
+					jsTypeDesc(p, m.Args[y].Type), arg, quoteString(m.Args[y].Name)))
+			}
+			onSuccess := "onSuccess"
+			if !m.ReturnType.IsVoid && jsNeedsConversion(p, m.ReturnType) {
+				onSuccess = fmt.Sprintf("function(_r) { onSuccess(_util.toWire(_types, %s, _r)); }",
+					jsTypeDesc(p, m.ReturnType))
+			}
+			if m.ReturnType.IsOptional {
+				onSuccess = "_optional(" + onSuccess + ")"
+			}
+			onError := "onError"
+			if len(m.Throws) > 0 {
+				onError = fmt.Sprintf("function(_c, _m, _d) {\n"+
+					"            var _e = _util.typedError(_types, %s, { \"code\" : _c, \"message\" : _m, \"data\" : _d }, true);\n"+
+					"            onError(_e.code, _e.message, _e.data);\n"+
+					"        }", jsErrorNames(p, m))
+			}
+			args = append(args, onSuccess, onError)
+			call := fmt.Sprintf("svc.%s(%s);", m.Name, strings.Join(args, ", "))
+
+			if len(checks) == 0 {
+				b.f("        %s", call)
+			} else {
+				b.f("        _err = %s;", strings.Join(checks, " ||\n               "))
+				b.w("        if (_err) {")
+				b.w("            onError(-32602, \"Invalid params: \" + _err);")
+				b.w("        } else {")
+				b.f("            %s", call)
+				b.w("        }")
 			}
 			b.w("    }")
 		}
@@ -96,44 +591,158 @@ func (g NodeJsGenerator) GenFiles(p *Package) []File {
 		b.w("};")
 
 		b.blank()
+		b.doc("", iface.Comment, deprecatedDocTags(iface.Annotations)...)
 		b.f("exports.%sClient = function(_url) {", iface.Name)
-		GenJsClientFunc(iface, b, "_util")
+		GenJsClientFunc(p, iface, b, "_util", "_types")
 		b.w("};")
 	}
 
 	file := File{JsFilename(p.Name + "-node"), b.b.Bytes()}
-	return []File{file}
+	return append([]File{file}, genJsImportFiles(p, true)...)
 }
 
-func GenJsClientFunc(iface Interface, b *StrBuf, utilname string) {
+// GenJsClientFunc writes the body of the client constructor for iface.
+// utilname is the object holding the rpc helpers and typesname the
+// object holding the package's type descriptors.
+func GenJsClientFunc(p *Package, iface Interface, b *StrBuf, utilname string, typesname string) {
 	b.w("        var _me = {};")
+	jsDeprecationWarning(b, "        ", iface.Name, iface.Annotations)
 	b.w("        var _tmp = _urlmod.parse(_url);")
 	b.w("        _url = { 'host': _tmp.hostname, 'port': _tmp.port, 'path': _tmp.pathname, 'protocol': _tmp.protocol };")
 	for x := 0; x < len(iface.Methods); x++ {
 		m := iface.Methods[x]
+		genJsMethodDoc(p, m, b)
+		args := make([]string, 0)
+		wireArgs := make([]string, 0)
+		for y := 0; y < len(m.Args); y++ {
+			arg := m.Args[y]
+			name := jsIdent(arg.Name)
+			args = append(args, name)
+			if jsNeedsConversion(p, arg.Type) {
+				wireArgs = append(wireArgs, fmt.Sprintf("%s.toWire(%s, %s, %s)",
+					utilname, typesname, jsTypeDesc(p, arg.Type), name))
+			} else {
+				wireArgs = append(wireArgs, name)
+			}
+		}
 		if len(m.Args) == 0 {
 			b.f("        _me.%s = function(_onSuccess, _onError) {", m.Name)
 			b.w("            var _args = null;")
 		} else if len(m.Args) == 1 {
-			b.f("        _me.%s = function(%s, _onSuccess, _onError) {", m.Name, m.Args[0].Name)
-			b.f("            var _args = %s;", m.Args[0].Name)
+			b.f("        _me.%s = function(%s, _onSuccess, _onError) {", m.Name, args[0])
+			b.f("            var _args = %s;", wireArgs[0])
 		} else {
-			args := ""
-			for y := 0; y < len(m.Args); y++ {
-				if y > 0 {
-					args += ", "
-				}
-				args += m.Args[y].Name
-			}
-			b.f("        _me.%s = function(%s, _onSuccess, _onError) {", m.Name, args)
-			b.f("            var _args = [ %s ];", args)
+			b.f("        _me.%s = function(%s, _onSuccess, _onError) {", m.Name, strings.Join(args, ", "))
+			b.f("            var _args = [ %s ];", strings.Join(wireArgs, ", "))
 		}
-		b.f("            %s.rpcCall(_url, \"%s_%s\", _args, _onSuccess, _onError);", utilname, iface.Name, m.Name)
+		jsDeprecationWarning(b, "            ", iface.Name+"."+m.Name, m.Annotations)
+		onSuccess := "_onSuccess"
+		if r := jsFromWire(p, m.ReturnType, utilname, typesname, "_r"); !m.ReturnType.IsVoid && r != "_r" {
+			onSuccess = fmt.Sprintf("function(_r) { _onSuccess(%s); }", r)
+		}
+		onError := "_onError"
+		if len(m.Throws) > 0 {
+			onError = fmt.Sprintf("function(_e) { _onError(%s.typedError(%s, %s, _e, false)); }",
+				utilname, typesname, jsErrorNames(p, m))
+		}
+		b.f("            %s.rpcCall(_url, \"%s_%s\", _args, %s, %s);", utilname, iface.Name, m.Name, onSuccess, onError)
 		b.w("        };")
 	}
 	b.w("        return _me;")
 }
 
+// jsFromWire returns the expression that converts val, a value of type t
+// received as JSON, for use in JavaScript. Missing fields with defaults
+// are set, and wire types are converted by fromWire. Returns val if
+// neither is needed.
+func jsFromWire(p *Package, t PolyType, utilname string, typesname string, val string) string {
+	if jsHasDefaults(p, t, make(map[string]bool)) {
+		val = fmt.Sprintf("%s.withDefaults(%s, %s, %s)", utilname, typesname, jsTypeDesc(p, t), val)
+	}
+	if jsNeedsConversion(p, t) {
+		val = fmt.Sprintf("%s.fromWire(%s, %s, %s)", utilname, typesname, jsTypeDesc(p, t), val)
+	}
+	return val
+}
+
+// jsHasDefaults returns true if t is, or contains, a struct with a field
+// that has a default
+func jsHasDefaults(p *Package, t PolyType, seen map[string]bool) bool {
+	if t.Elem != nil {
+		return jsHasDefaults(p, *t.Elem, seen)
+	}
+	s := p.ResolveStruct(t)
+	name := jsTypeName(p, t)
+	if s == nil || seen[name] {
+		return false
+	}
+	seen[name] = true
+	tp := p.TypePackage(t)
+	for _, prop := range tp.StructFields(s) {
+		if prop.Constraints.Default != nil || jsHasDefaults(tp, prop.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsErrorNames returns an array literal of the qualified names of the
+// error types m declares
+func jsErrorNames(p *Package, m Method) string {
+	names := make([]string, 0)
+	for _, t := range m.Throws {
+		names = append(names, quoteString(jsTypeName(p, t)))
+	}
+	return "[ " + strings.Join(names, ", ") + " ]"
+}
+
+// jsDeprecationWarning writes a statement that logs a warning that name
+// is deprecated, if a declaration with the annotations a is deprecated
+func jsDeprecationWarning(b *StrBuf, indent string, name string, a Annotations) {
+	if a.Has("deprecated") {
+		msg := strings.TrimSpace(name + " is deprecated. " + a["deprecated"])
+		b.f("%sconsole.warn(%s);", indent, quoteString(msg))
+	}
+}
+
+// jsWireTypes are the builtin types whose JavaScript values differ from
+// their JSON encoding, and so are converted by the toWire and fromWire
+// helpers
+var jsWireTypes = map[string]bool{"[]byte": true, "time": true}
+
+// jsNeedsConversion returns true if values of type t contain any
+// jsWireTypes or int64 values sent as strings, and so must be converted
+// to and from the wire, or any sets, which are deduplicated by the
+// conversion
+func jsNeedsConversion(p *Package, t PolyType) bool {
+	return jsContainsWireType(p, t, make(map[string]bool))
+}
+
+func jsContainsWireType(p *Package, t PolyType, seen map[string]bool) bool {
+	if t.IsSet {
+		return true
+	} else if t.Elem != nil {
+		return jsContainsWireType(p, *t.Elem, seen)
+	} else if jsWireTypes[t.GoType] || p.sendsInt64String(t) {
+		return true
+	} else if sc := p.ResolveScalar(t); sc != nil {
+		return jsContainsWireType(p.TypePackage(t), sc.Type, seen)
+	}
+	s := p.ResolveStruct(t)
+	name := jsTypeName(p, t)
+	if s == nil || seen[name] {
+		return false
+	}
+	seen[name] = true
+	tp := p.TypePackage(t)
+	for _, prop := range tp.StructFields(s) {
+		if jsContainsWireType(tp, prop.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 var jsPostBoilerplate = `    post : function(url, obj, callback) {
         var json = JSON.stringify(obj);
         jQuery.ajax({ type: 'POST', 
@@ -161,7 +770,7 @@ var jsBoilerplate = `    S4 : function() {
             if (rpcResp && rpcResp.error) {
                 onError(rpcResp.error);
             }
-            else if (rpcResp && rpcResp.result) {
+            else if (rpcResp && rpcResp.result !== undefined) {
                 onSuccess(rpcResp.result);
             }
             else {
@@ -169,6 +778,150 @@ var jsBoilerplate = `    S4 : function() {
                           "message" : "Invalid response: " + rpcResp });
             }
         });
+    },
+
+    // toWire converts val, described by type, to the form sent as JSON.
+    // Binary data is sent as a base64 string, Dates as RFC 3339 strings
+    // and BigInts as decimal strings. Duplicate values are removed from
+    // sets.
+    toWire : function(types, type, val) {
+        return this.convert(types, type, val, true);
+    },
+
+    // fromWire is the inverse of toWire
+    fromWire : function(types, type, val) {
+        return this.convert(types, type, val, false);
+    },
+
+    // withDefaults sets the fields of val, described by type, that are
+    // missing and have a default. val is modified in place and returned.
+    withDefaults : function(types, type, val) {
+        var i, f, t;
+        if (val === null || val === undefined) {
+            return val;
+        }
+        if (typeof type === 'object') {
+            for (i in val) {
+                if (val.hasOwnProperty(i)) {
+                    this.withDefaults(types, type.list || type.map, val[i]);
+                }
+            }
+            return val;
+        }
+        t = types[type];
+        if (t && t.union && t.variants.hasOwnProperty(val[t.union])) {
+            return this.withDefaults(types, t.variants[val[t.union]], val);
+        }
+        if (t && t.fields) {
+            for (i = 0; i < t.fields.length; i++) {
+                f = t.fields[i];
+                if (val[f.name] === undefined && f["default"] !== undefined) {
+                    val[f.name] = f["default"];
+                } else {
+                    this.withDefaults(types, f.type, val[f.name]);
+                }
+            }
+        }
+        return val;
+    },
+
+    convert : function(types, type, val, toWire) {
+        var i, name, out, t, v;
+        if (val === null || val === undefined) {
+            return val;
+        }
+        if (typeof type === 'object') {
+            if (type.list) {
+                out = [];
+                for (i = 0; i < val.length; i++) {
+                    v = this.convert(types, type.list, val[i], toWire);
+                    if (!type.set || out.indexOf(v) < 0) {
+                        out.push(v);
+                    }
+                }
+                return out;
+            }
+            out = {};
+            for (i in val) {
+                if (val.hasOwnProperty(i)) {
+                    out[i] = this.convert(types, type.map, val[i], toWire);
+                }
+            }
+            return out;
+        }
+        if (type === "[]byte") {
+            return toWire ? this.encodeBase64(val) : this.decodeBase64(val);
+        }
+        if (type === "time") {
+            return toWire ? new Date(val).toISOString() : new Date(val);
+        }
+        if (type === "int64:string") {
+            return toWire ? String(val) : BigInt(val);
+        }
+        t = types[type];
+        if (t && t.union) {
+            if (t.variants.hasOwnProperty(val[t.union])) {
+                return this.convert(types, t.variants[val[t.union]], val, toWire);
+            }
+            return val;
+        }
+        if (t && t.fields) {
+            out = {};
+            for (i in val) {
+                if (val.hasOwnProperty(i)) {
+                    out[i] = val[i];
+                }
+            }
+            for (i = 0; i < t.fields.length; i++) {
+                name = t.fields[i].name;
+                if (val[name] !== undefined) {
+                    out[name] = this.convert(types, t.fields[i].type, val[name], toWire);
+                }
+            }
+            return out;
+        }
+        return val;
+    },
+
+    // encodeBase64 encodes a Uint8Array (or node Buffer) as base64
+    encodeBase64 : function(bytes) {
+        var i, s = "";
+        if (typeof Buffer !== 'undefined') {
+            return Buffer.from(bytes).toString('base64');
+        }
+        for (i = 0; i < bytes.length; i++) {
+            s += String.fromCharCode(bytes[i]);
+        }
+        return btoa(s);
+    },
+
+    // decodeBase64 decodes a base64 string to a node Buffer, or to a
+    // Uint8Array in the browser
+    decodeBase64 : function(s) {
+        var i, bin, bytes;
+        if (typeof Buffer !== 'undefined') {
+            return Buffer.from(s, 'base64');
+        }
+        bin = atob(s);
+        bytes = new Uint8Array(bin.length);
+        for (i = 0; i < bin.length; i++) {
+            bytes[i] = bin.charCodeAt(i);
+        }
+        return bytes;
+    },
+
+    // typedError sets the type of err to the short name of the error type
+    // in names with the same code, and converts its data
+    typedError : function(types, names, err, toWire) {
+        var i, t;
+        for (i = 0; i < names.length; i++) {
+            t = types[names[i]];
+            if (err && t && t.error === err.code) {
+                err.type = names[i].substring(names[i].lastIndexOf(".") + 1);
+                err.data = this.convert(types, names[i], err.data, toWire);
+            }
+        }
+        return err;
     }`
 
 var nodePostBoilerplate = `    post : function(urlInfo, obj, callback) {
@@ -207,6 +960,14 @@ var nodePostBoilerplate = `    post : function(urlInfo, obj, callback) {
         req.end();
     },`
 
+var nodeOptionalBoilerplate = `// wraps onSuccess for methods with an optional return type, so that
+// a missing result is sent as null rather than true
+var _optional = function(onSuccess) {
+    return function(data) {
+        onSuccess(data === undefined ? null : data);
+    };
+};`
+
 var nodeReadRequestBoilerplate = `exports.ReadServerRequest = function(req, maxlen, onSuccess, onError) {
     var body = '';
     req.on('data', function(chunk) { 
@@ -222,6 +983,95 @@ var nodeReadRequestBoilerplate = `exports.ReadServerRequest = function(req, maxl
 
 var nodeBoilerplate = jsBoilerplate + `,
 
+    required : function(val, path) {
+        if (val === null || val === undefined) {
+            return "missing required param: " + path;
+        }
+        return null;
+    },
+
+    rfc3339 : /^\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})$/,
+
+    decimal : /^-?\d+(\.\d+)?$/,
+
+    check : function(types, type, val, path) {
+        var i, err = null;
+        if (val === null || val === undefined) {
+            return null;
+        }
+        if (typeof type === 'object') {
+            if (type.list && Array.isArray(val)) {
+                if (type.length !== undefined && val.length !== type.length) {
+                    return path + " must have length " + type.length;
+                }
+                for (i = 0; i < val.length && !err; i++) {
+                    err = this.check(types, type.list, val[i], path + "[" + i + "]");
+                }
+            }
+            else if (type.map && typeof val === 'object') {
+                for (i in val) {
+                    if (val.hasOwnProperty(i) && !err) {
+                        err = this.check(types, type.map, val[i], path + "[" + JSON.stringify(i) + "]");
+                    }
+                }
+            }
+            return err;
+        }
+
+        if (type === "[]byte" && typeof val !== 'string') {
+            return path + " must be a base64 string";
+        }
+        if (type === "time" && (typeof val !== 'string' || !this.rfc3339.test(val))) {
+            return path + " must be an RFC 3339 date-time";
+        }
+        if (type === "decimal" && (typeof val !== 'string' || !this.decimal.test(val))) {
+            return path + " must be a decimal string";
+        }
+        if (type === "int64:string" && (typeof val !== 'string' || !/^-?\d+$/.test(val))) {
+            return path + " must be an integer string";
+        }
+        var t = types[type];
+        if (t && t.enum && t.enum.indexOf(val) < 0) {
+            return path + " must be one of: " + t.enum.join(", ");
+        }
+        else if (t && t.union && typeof val === 'object') {
+            if (!t.variants.hasOwnProperty(val[t.union])) {
+                return path + "." + t.union + " must be one of: " + Object.keys(t.variants).join(", ");
+            }
+            err = this.check(types, t.variants[val[t.union]], val, path);
+        }
+        else if (t && t.fields && typeof val === 'object') {
+            for (i = 0; i < t.fields.length && !err; i++) {
+                err = this.checkField(types, t.fields[i], val[t.fields[i].name],
+                                      path + "." + t.fields[i].name);
+            }
+        }
+        return err;
+    },
+
+    checkField : function(types, f, val, path) {
+        if (val === null || val === undefined) {
+            return f.required ? path + " is required" : null;
+        }
+        if (f.pattern !== undefined && typeof val === 'string' && !new RegExp(f.pattern).test(val)) {
+            return path + " does not match pattern: " + f.pattern;
+        }
+        if (f.min !== undefined && val < f.min) {
+            return path + " must be >= " + f.min;
+        }
+        if (f.max !== undefined && val > f.max) {
+            return path + " must be <= " + f.max;
+        }
+        var len = (typeof val === 'object' && !Array.isArray(val)) ? Object.keys(val).length : val.length;
+        if (f.minLength !== undefined && len < f.minLength) {
+            return path + " length must be >= " + f.minLength;
+        }
+        if (f.maxLength !== undefined && len > f.maxLength) {
+            return path + " length must be <= " + f.maxLength;
+        }
+        return this.check(types, f.type, val, path);
+    },
+
     createServer : function(httpMod, dispatcher, svc, maxPostLength) {
         var sendResp = function(res, jsonresp) {
             var respdata = JSON.stringify(jsonresp);
@@ -235,15 +1085,18 @@ var nodeBoilerplate = jsBoilerplate + `,
                 var jsonresp = { "jsonrpc": "2.0", "id" : jsonreq.id };
             
                 var onSuccess = function(data) {
-                    if ((data === null) || (data === undefined)) {
+                    if (data === undefined) {
                         data = true;
                     }
                     jsonresp.result = data;
                     sendResp(res, jsonresp);
                 };
             
-                var onError = function(code, message) {
+                var onError = function(code, message, data) {
                     jsonresp.error = { "code" : code, "message" : message };
+                    if (data !== undefined) {
+                        jsonresp.error.data = data;
+                    }
                     sendResp(res, jsonresp);
                 };
                 
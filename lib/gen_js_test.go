@@ -3,6 +3,7 @@ package polygenlib
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +28,132 @@ func TestJsGenerator(t *testing.T) {
 	}
 
 }
+
+func TestJsNeedsConversion(t *testing.T) {
+	idl := `package foo
+
+type Image struct {
+	Data []byte
+}
+
+type Album struct {
+	Images map[string][]Image
+	Parent *Album
+}
+
+type Person struct {
+	Name string
+	Friends []Person
+}
+
+type Post struct {
+	Tags map[string]struct{}
+}`
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{"Image": true, "Album": true, "Person": false, "Post": true}
+	for name, expected := range cases {
+		if jsNeedsConversion(pkg, PolyType{GoType: name}) != expected {
+			t.Errorf("%s: expected %v", name, expected)
+		}
+	}
+}
+
+func TestJsScalarTypedef(t *testing.T) {
+	pkg, err := Parse("test.go", "package foo\n\n// Cents is an amount of money\ntype Cents int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewStrBuf("//")
+	GenJsTypedefs(pkg, b)
+	expected := "\n/**\n * Cents is an amount of money\n * @typedef {number} Cents\n */\n"
+	if b.b.String() != expected {
+		t.Errorf("Unexpected typedef:\n%s", b.b.String())
+	}
+}
+
+func TestJsTypeDesc(t *testing.T) {
+	pkg, err := Parse("test.go", "package foo\n\ntype Point struct {\n Coords [3]float\n Tags map[string]struct{}\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := pkg.Structs[0].Props
+	if d := jsTypeDesc(pkg, props[0].Type); d != `{ "list" : "float", "length" : 3 }` {
+		t.Errorf("Unexpected type descriptor: %s", d)
+	}
+	if d := jsTypeDesc(pkg, props[1].Type); d != `{ "list" : "string", "set" : true }` {
+		t.Errorf("Unexpected type descriptor: %s", d)
+	}
+
+	pkg, err = Parse("test.go", "package foo\n\ntype Price decimal\n\ntype Item struct {\n Price Price\n History []Price\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	props = pkg.Structs[0].Props
+	if d := jsTypeDesc(pkg, props[0].Type); d != `"decimal"` {
+		t.Errorf("Unexpected type descriptor: %s", d)
+	}
+	if d := jsTypeDesc(pkg, props[1].Type); d != `{ "list" : "decimal" }` {
+		t.Errorf("Unexpected type descriptor: %s", d)
+	}
+	if JsType(pkg, props[0].Type) != "Price" || jsNeedsConversion(pkg, PolyType{GoType: "Item"}) {
+		t.Errorf("Decimals should be strings")
+	}
+}
+
+func TestJsInt64String(t *testing.T) {
+	idl := "//polygen:int64 string\npackage foo\n\ntype Id int64\n\ntype Sample struct {\n Id Id\n Counts map[string]int64\n Small int32\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := pkg.Structs[0].Props
+	if d := jsTypeDesc(pkg, props[0].Type); d != `"int64:string"` {
+		t.Errorf("Unexpected type descriptor: %s", d)
+	}
+	if JsType(pkg, props[1].Type) != "Object.<string, bigint>" || JsType(pkg, props[2].Type) != "number" {
+		t.Errorf("Unexpected types: %s %s", JsType(pkg, props[1].Type), JsType(pkg, props[2].Type))
+	}
+	if !jsNeedsConversion(pkg, PolyType{GoType: "Sample"}) {
+		t.Errorf("Sample should need conversion")
+	}
+	pkg.Int64Encoding = ""
+	if jsNeedsConversion(pkg, PolyType{GoType: "Sample"}) || JsType(pkg, props[1].Type) != "Object.<string, number>" {
+		t.Errorf("int64 numbers should not need conversion")
+	}
+}
+
+func TestJsCheckIdentifiers(t *testing.T) {
+	idl := "package function\n\ntype Svc interface {\n Get(class string, name string) bool\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Package function is reserved in JavaScript\n" +
+		"test.go:4: Argument class of Svc.Get is reserved in JavaScript (enable escaping to generate class_)"
+	err = (NodeJsGenerator{}).CheckIdentifiers(pkg, false)
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected errors: %v", err)
+	}
+
+	pkg, err = Parse("test.go", "package foo\n\nconst uuid = \"x\"\nconst SvcClient = 1\n\ntype Svc interface {\n Get() bool\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (JsGenerator{}).CheckIdentifiers(pkg, false)
+	if err == nil || err.Error() != "test.go:3: Constant uuid clashes with JavaScript helper foo.uuid" {
+		t.Errorf("Unexpected errors: %v", err)
+	}
+	err = (NodeJsGenerator{}).CheckIdentifiers(pkg, false)
+	if err == nil || err.Error() != "test.go:4: Constant SvcClient clashes with JavaScript export SvcClient" {
+		t.Errorf("Unexpected errors: %v", err)
+	}
+
+	pkg, _ = Parse("test.go", "package foo\n\ntype Svc interface {\n Get(class string, name string) bool\n}")
+	contents := string((JsGenerator{}).GenFiles(pkg)[0].Contents)
+	if !strings.Contains(contents, "_me.Get = function(class_, name, _onSuccess, _onError) {") {
+		t.Errorf("Arguments not escaped:\n%s", contents)
+	}
+}
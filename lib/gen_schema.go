@@ -1,7 +1,224 @@
 package polygenlib
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JsonSchemaGenerator writes a JSON Schema (draft-07) document with a
+// definition for each struct, enum, union and named scalar in the package
+// and the packages it imports. Definitions are keyed by qualified name,
+// e.g. "#/definitions/svc.Person".
 type JsonSchemaGenerator struct{}
 
-func (g JsonSchemaGenerator) GenFiles(p Package) []File {
-	return nil
+func (g JsonSchemaGenerator) GenFiles(p *Package) []File {
+	defs := &schemaObj{}
+	for _, pkg := range append(p.AllImports(), p) {
+		for i := 0; i < len(pkg.Enums); i++ {
+			e := pkg.Enums[i]
+			vals := make([]string, 0)
+			for _, ev := range e.Values {
+				vals = append(vals, ev.Value)
+			}
+			def := (&schemaObj{}).set("type", "string").set("enum", vals)
+			defs.set(pkg.Name+"."+e.Name, withDescription(def, e.Comment))
+		}
+		for i := 0; i < len(pkg.Scalars); i++ {
+			sc := pkg.Scalars[i]
+			defs.set(pkg.Name+"."+sc.Name, withDescription(schemaType(pkg, sc.Type), sc.Comment))
+		}
+		for i := 0; i < len(pkg.Structs); i++ {
+			s := pkg.Structs[i]
+			defs.set(pkg.Name+"."+s.Name, withDescription(schemaStruct(pkg, &s), s.Comment))
+		}
+	}
+
+	root := (&schemaObj{}).set("$schema", "http://json-schema.org/draft-07/schema#").
+		set("title", p.Name).set("definitions", defs)
+	out, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		// only the values built above are marshalled. The only ones that
+		// could fail are NaN and infinite floats, which the parser and
+		// ReadIR reject as defaults. JSON has no such numbers, so mins and
+		// maxes read from IR are always finite.
+		panic(err)
+	}
+	return []File{File{p.Name + ".schema.json", append(out, '\n')}}
+}
+
+// schemaStruct returns the schema for the struct or union s
+func schemaStruct(p *Package, s *Struct) *schemaObj {
+	if s.IsUnion() {
+		variants := make([]interface{}, 0)
+		for _, prop := range s.Props {
+			disc := (&schemaObj{}).set(s.Discriminator(), (&schemaObj{}).set("const", VariantName(prop)))
+			tag := (&schemaObj{}).set("properties", disc).set("required", []string{s.Discriminator()})
+			variants = append(variants, (&schemaObj{}).set("allOf", []interface{}{schemaType(p, prop.Type), tag}))
+		}
+		return (&schemaObj{}).set("oneOf", variants)
+	}
+
+	props := &schemaObj{}
+	required := make([]string, 0)
+	for _, prop := range p.StructFields(s) {
+		props.set(WireName(prop), withDescription(schemaField(p, prop), prop.Comment))
+		if prop.Constraints.Required {
+			required = append(required, WireName(prop))
+		}
+	}
+	def := (&schemaObj{}).set("type", "object").set("properties", props)
+	if len(required) > 0 {
+		def.set("required", required)
+	}
+	return def
+}
+
+// schemaField returns the schema for a struct field, including the
+// constraints and default declared in its tag
+func schemaField(p *Package, prop Property) *schemaObj {
+	t := prop.Type
+	t.IsOptional = false
+	f := schemaType(p, t)
+	c := prop.Constraints
+	if _, ok := f.vals["$ref"]; ok && (c.Default != nil || prop.Comment != "") {
+		// keywords beside a $ref are ignored, so the reference is wrapped
+		f = (&schemaObj{}).set("allOf", []interface{}{f})
+	}
+	if c.Pattern != "" {
+		f.set("pattern", c.Pattern)
+	}
+	if c.Min != nil {
+		f.set("minimum", *c.Min)
+	}
+	if c.Max != nil {
+		f.set("maximum", *c.Max)
+	}
+	minKey, maxKey := "minLength", "maxLength"
+	if t.IsList {
+		minKey, maxKey = "minItems", "maxItems"
+	} else if t.IsMap {
+		minKey, maxKey = "minProperties", "maxProperties"
+	}
+	if c.MinLength != nil {
+		f.set(minKey, *c.MinLength)
+	}
+	if c.MaxLength != nil {
+		f.set(maxKey, *c.MaxLength)
+	}
+	if c.Default != nil {
+		f.set("default", schemaDefault(p, prop))
+	}
+	if prop.Type.IsOptional {
+		return (&schemaObj{}).set("anyOf", []interface{}{f, (&schemaObj{}).set("type", "null")})
+	}
+	return f
+}
+
+// schemaType returns the schema for values of type t
+func schemaType(p *Package, t PolyType) *schemaObj {
+	var s *schemaObj
+	if t.IsList {
+		s = (&schemaObj{}).set("type", "array").set("items", schemaType(p, *t.Elem))
+		if t.IsSet {
+			s.set("uniqueItems", true)
+		} else if t.Length > 0 {
+			s.set("minItems", t.Length).set("maxItems", t.Length)
+		}
+	} else if t.IsMap {
+		s = (&schemaObj{}).set("type", "object").set("additionalProperties", schemaType(p, *t.Elem))
+	} else {
+		switch t.GoType {
+		case "int":
+			s = (&schemaObj{}).set("type", "integer")
+		case "int32":
+			s = (&schemaObj{}).set("type", "integer").set("format", "int32")
+		case "int64":
+			if p.Int64AsString() {
+				s = (&schemaObj{}).set("type", "string").set("pattern", "^-?[0-9]+$")
+			} else {
+				s = (&schemaObj{}).set("type", "integer").set("format", "int64")
+			}
+		case "float", "float64":
+			s = (&schemaObj{}).set("type", "number")
+		case "float32":
+			s = (&schemaObj{}).set("type", "number").set("format", "float")
+		case "bool":
+			s = (&schemaObj{}).set("type", "boolean")
+		case "string":
+			s = (&schemaObj{}).set("type", "string")
+		case "[]byte":
+			s = (&schemaObj{}).set("type", "string").set("contentEncoding", "base64")
+		case "time":
+			s = (&schemaObj{}).set("type", "string").set("format", "date-time")
+		case "decimal":
+			s = (&schemaObj{}).set("type", "string").set("pattern", "^-?[0-9]+(\\.[0-9]+)?$")
+		default:
+			s = (&schemaObj{}).set("$ref", "#/definitions/"+p.TypePackage(t).Name+"."+t.GoType)
+		}
+	}
+	if t.IsOptional {
+		return (&schemaObj{}).set("anyOf", []interface{}{s, (&schemaObj{}).set("type", "null")})
+	}
+	return s
+}
+
+// schemaDefault returns the default of prop, a field of a struct in p, as
+// a JSON value
+func schemaDefault(p *Package, prop Property) interface{} {
+	val := *prop.Constraints.Default
+	if p.sendsInt64String(prop.Type) {
+		return val
+	} else if isInteger(prop.Type.GoType) || isFloat(prop.Type.GoType) {
+		return json.Number(val)
+	} else if prop.Type.GoType == "bool" {
+		return val == "true"
+	}
+	return val
+}
+
+// withDescription sets the description of the schema s, if comment is
+// not empty
+func withDescription(s *schemaObj, comment string) *schemaObj {
+	if comment != "" {
+		s.set("description", comment)
+	}
+	return s
+}
+
+// schemaObj is a JSON object that is marshalled with its keys in the
+// order they were set
+type schemaObj struct {
+	keys []string
+	vals map[string]interface{}
+}
+
+func (o *schemaObj) set(key string, val interface{}) *schemaObj {
+	if o.vals == nil {
+		o.vals = make(map[string]interface{})
+	}
+	if _, ok := o.vals[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.vals[key] = val
+	return o
+}
+
+func (o *schemaObj) MarshalJSON() ([]byte, error) {
+	b := bytes.Buffer{}
+	b.WriteString("{")
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(o.vals[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteString(":")
+		b.Write(v)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
 }
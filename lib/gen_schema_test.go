@@ -0,0 +1,88 @@
+package polygenlib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJsonSchemaGenerator(t *testing.T) {
+	idl := "package foo\n\ntype Settings struct {\n PageSize int `default:20 min:1`\n Tags []string\n Roles map[string]struct{}\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := (JsonSchemaGenerator{}).GenFiles(pkg)
+	if len(files) != 1 || files[0].Name != "foo.schema.json" {
+		t.Fatalf("Unexpected files: %v", files)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(files[0].Contents, &schema); err != nil {
+		t.Fatal(err)
+	}
+	defs := schema["definitions"].(map[string]interface{})
+	props := defs["foo.Settings"].(map[string]interface{})["properties"].(map[string]interface{})
+	expected := map[string]interface{}{"type": "integer", "minimum": 1.0, "default": 20.0}
+	if !reflect.DeepEqual(props["pageSize"], expected) {
+		t.Errorf("Unexpected schema for pageSize: %v", props["pageSize"])
+	}
+	expected = map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	if !reflect.DeepEqual(props["tags"], expected) {
+		t.Errorf("Unexpected schema for tags: %v", props["tags"])
+	}
+	expected["uniqueItems"] = true
+	if !reflect.DeepEqual(props["roles"], expected) {
+		t.Errorf("Unexpected schema for roles: %v", props["roles"])
+	}
+}
+
+func TestJsonSchemaDecimal(t *testing.T) {
+	idl := "package foo\n\ntype Price decimal\n\ntype Item struct {\n Price Price\n Tax decimal\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal((JsonSchemaGenerator{}).GenFiles(pkg)[0].Contents, &schema); err != nil {
+		t.Fatal(err)
+	}
+	defs := schema["definitions"].(map[string]interface{})
+	expected := map[string]interface{}{"type": "string", "pattern": "^-?[0-9]+(\\.[0-9]+)?$"}
+	if !reflect.DeepEqual(defs["foo.Price"], expected) {
+		t.Errorf("Unexpected schema for Price: %v", defs["foo.Price"])
+	}
+	props := defs["foo.Item"].(map[string]interface{})["properties"].(map[string]interface{})
+	if !reflect.DeepEqual(props["tax"], expected) {
+		t.Errorf("Unexpected schema for tax: %v", props["tax"])
+	}
+	ref := map[string]interface{}{"$ref": "#/definitions/foo.Price"}
+	if !reflect.DeepEqual(props["price"], ref) {
+		t.Errorf("Unexpected schema for price: %v", props["price"])
+	}
+}
+
+func TestJsonSchemaInt64String(t *testing.T) {
+	idl := "//polygen:int64 string\npackage foo\n\ntype AccountId int64\n\ntype Sample struct {\n Id int64 `default:7`\n Small int32\n Account AccountId\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal((JsonSchemaGenerator{}).GenFiles(pkg)[0].Contents, &schema); err != nil {
+		t.Fatal(err)
+	}
+	defs := schema["definitions"].(map[string]interface{})
+	props := defs["foo.Sample"].(map[string]interface{})["properties"].(map[string]interface{})
+	expected := map[string]interface{}{"type": "string", "pattern": "^-?[0-9]+$", "default": "7"}
+	if !reflect.DeepEqual(props["id"], expected) {
+		t.Errorf("Unexpected schema for id: %v", props["id"])
+	}
+	expected = map[string]interface{}{"type": "integer", "format": "int32"}
+	if !reflect.DeepEqual(props["small"], expected) {
+		t.Errorf("Unexpected schema for small: %v", props["small"])
+	}
+	ref := map[string]interface{}{"$ref": "#/definitions/foo.AccountId"}
+	if !reflect.DeepEqual(props["account"], ref) {
+		t.Errorf("Unexpected schema for account: %v", props["account"])
+	}
+}
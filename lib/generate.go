@@ -2,9 +2,13 @@ package polygenlib
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"go/token"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -12,6 +16,127 @@ type CodeGenerator interface {
 	GenFiles(p *Package) []File
 }
 
+// IdentifierChecker is implemented by generators whose target language
+// reserves names that are valid in the IDL, such as a Java field named
+// class. CheckIdentifiers returns an ErrorList with an error for each
+// name in p, or the packages it imports, that the generator can't use,
+// and nil if there are none. It is called before GenFiles.
+//
+// GenFiles escapes reserved struct field, argument, method, enum value
+// and constant names by appending an underscore (class_), leaving their
+// wire names unchanged. If escape is true these names are not reported.
+type IdentifierChecker interface {
+	CheckIdentifiers(p *Package, escape bool) error
+}
+
+// reservedChecker collects the errors found by an IdentifierChecker
+type reservedChecker struct {
+	lang     string
+	reserved map[string]bool
+	escape   bool
+	errs     ErrorList
+}
+
+// check reports ident, the name generated for the IDL name declared at
+// pos, if it is reserved. what describes the name, e.g. "Field
+// Person.Class". Names that can't be escaped are always reported.
+func (c *reservedChecker) check(pos token.Position, what string, name string, ident string, escapable bool) {
+	if !c.reserved[ident] || (escapable && c.escape) {
+		return
+	}
+	msg := fmt.Sprintf("%s is reserved in %s", what, c.lang)
+	if ident != name {
+		msg = fmt.Sprintf("%s is generated as %s, which is reserved in %s", what, ident, c.lang)
+	}
+	if escapable {
+		msg += fmt.Sprintf(" (enable escaping to generate %s_)", ident)
+	}
+	c.errs = append(c.errs, nameErr(pos, CodeReservedWord, name, msg))
+}
+
+// generatedName is a name a generator declares beside the types of the
+// IDL, such as the client class of an interface. from is the declaration
+// the name is generated for, and is empty for names that are always
+// generated.
+type generatedName struct {
+	name string
+	what string
+	from declaredName
+}
+
+// checkGenerated reports the IDL names that are the same as one of the
+// generated names, ignoring case if foldCase is true. Such names can't be
+// escaped.
+func (c *reservedChecker) checkGenerated(names []declaredName, generated []generatedName, foldCase bool) {
+	for _, d := range names {
+		for _, g := range generated {
+			if d.name != g.name && !(foldCase && strings.EqualFold(d.name, g.name)) {
+				continue
+			}
+			msg := fmt.Sprintf("%s clashes with %s %s", d.what, c.lang, g.what)
+			e := nameErr(d.pos, CodeDuplicateName, d.name, msg)
+			if g.from.name != "" {
+				msg := fmt.Sprintf("%s is generated for %s", g.name, lowerFirst(g.from.what))
+				e.Related = []PolyError{nameErr(g.from.pos, "", g.from.name, msg)}
+			}
+			c.errs = append(c.errs, e)
+		}
+	}
+}
+
+// typeNames returns the names of the structs, enums and interfaces of p
+func typeNames(p *Package) []declaredName {
+	names := make([]declaredName, 0)
+	for _, s := range p.Structs {
+		names = append(names, declaredName{"Struct " + s.Name, s.Name, s.Pos})
+	}
+	for _, e := range p.Enums {
+		names = append(names, declaredName{"Enum " + e.Name, e.Name, e.Pos})
+	}
+	for _, sc := range p.Scalars {
+		names = append(names, declaredName{"Type " + sc.Name, sc.Name, sc.Pos})
+	}
+	for _, iface := range p.Interfaces {
+		names = append(names, declaredName{"Interface " + iface.Name, iface.Name, iface.Pos})
+	}
+	return names
+}
+
+// checkPackage reports the package p if its name is reserved. The error
+// has no position, as a package is named in each of its files.
+func (c *reservedChecker) checkPackage(p *Package) {
+	if c.reserved[p.Name] {
+		msg := fmt.Sprintf("Package %s is reserved in %s", p.Name, c.lang)
+		c.errs = append(c.errs, PolyError{Code: CodeReservedWord, Message: msg})
+	}
+}
+
+// result returns the errors found, or nil if there were none
+func (c *reservedChecker) result() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
+
+// escapeReserved returns ident with an underscore appended if it is one
+// of the reserved words
+func escapeReserved(ident string, reserved map[string]bool) string {
+	if reserved[ident] {
+		return ident + "_"
+	}
+	return ident
+}
+
+// wordSet returns a set of the space separated words
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
 type File struct {
 	Name     string
 	Contents []byte
@@ -22,7 +147,12 @@ func (f File) FullPath(dir string) string {
 }
 
 func (f File) WriteTo(dir string) error {
-	out, err := os.Create(f.FullPath(dir))
+	fullpath := f.FullPath(dir)
+	err := os.MkdirAll(filepath.Dir(fullpath), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(fullpath)
 	if err != nil {
 		return err
 	}
@@ -32,6 +162,13 @@ func (f File) WriteTo(dir string) error {
 	return err
 }
 
+// quoteString returns s as a double quoted string literal that is valid
+// in both Java and JavaScript source
+func quoteString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
 type StrBuf struct {
 	commentDelim string
 	b            *bytes.Buffer
@@ -56,6 +193,30 @@ func (sb StrBuf) c(s string) {
 	sb.f("%s %s", sb.commentDelim, s)
 }
 
+// doc writes a /** */ style block comment, as used by both Javadoc and
+// JSDoc. Each entry in tags (e.g. "@param p") is written on its own line
+// after the comment text. Nothing is written if comment and tags are empty.
+func (sb StrBuf) doc(indent string, comment string, tags ...string) {
+	if comment == "" && len(tags) == 0 {
+		return
+	}
+	lines := make([]string, 0)
+	if comment != "" {
+		lines = append(lines, strings.Split(comment, "\n")...)
+	}
+	lines = append(lines, tags...)
+	sb.f("%s/**", indent)
+	for i := 0; i < len(lines); i++ {
+		if lines[i] == "" {
+			sb.f("%s *", indent)
+		} else {
+			line := strings.Replace(lines[i], "*/", "*&#47;", -1)
+			sb.f("%s * %s", indent, line)
+		}
+	}
+	sb.f("%s */", indent)
+}
+
 func (sb StrBuf) blank() {
 	sb.w("")
 }
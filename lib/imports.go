@@ -0,0 +1,213 @@
+package polygenlib
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Import is another IDL package imported by relative path, e.g.
+//
+//	import "../common"
+//
+// Types from an imported package are referenced by its package name,
+// e.g. common.Address
+type Import struct {
+	// Path is the import path as written in the IDL
+	Path string
+	Pkg  *Package
+	Pos  token.Position
+}
+
+// FindImport returns the imported package with the given name, or nil if
+// p does not import it
+func (p *Package) FindImport(name string) *Package {
+	for i := 0; i < len(p.Imports); i++ {
+		if p.Imports[i].Pkg.Name == name {
+			return p.Imports[i].Pkg
+		}
+	}
+	return nil
+}
+
+// AllImports returns every package imported by p, directly or indirectly.
+// Each package appears once, after the packages it imports.
+func (p *Package) AllImports() []*Package {
+	pkgs := make([]*Package, 0)
+	seen := make(map[*Package]bool)
+	var add func(pkg *Package)
+	add = func(pkg *Package) {
+		for i := 0; i < len(pkg.Imports); i++ {
+			imp := pkg.Imports[i].Pkg
+			if !seen[imp] {
+				seen[imp] = true
+				add(imp)
+				pkgs = append(pkgs, imp)
+			}
+		}
+	}
+	add(p)
+	return pkgs
+}
+
+// TypePackage returns the package that declares the element type of t.
+// This is p unless t refers to an imported type.
+func (p *Package) TypePackage(t PolyType) *Package {
+	if t.Package != "" {
+		for _, imp := range p.AllImports() {
+			if imp.Name == t.Package {
+				return imp
+			}
+		}
+	}
+	return p
+}
+
+// ResolveStruct returns the struct that t refers to, or nil if t does not
+// refer to a struct
+func (p *Package) ResolveStruct(t PolyType) *Struct {
+	return p.TypePackage(t).FindStruct(t.GoType)
+}
+
+// ResolveEnum returns the enum that t refers to, or nil if t does not
+// refer to an enum
+func (p *Package) ResolveEnum(t PolyType) *Enum {
+	return p.TypePackage(t).FindEnum(t.GoType)
+}
+
+// inPackage returns a copy of t as referenced from outside the package
+// pkg that declares it. Non-builtin types without a package are qualified
+// with pkg.
+func (t PolyType) inPackage(pkg string) PolyType {
+	if t.Elem != nil {
+		elem := t.Elem.inPackage(pkg)
+		t.Elem = &elem
+	}
+	if t.Package == "" && !IsBuiltin(t.GoType) {
+		t.Package = pkg
+	}
+	return t
+}
+
+// loader parses imported packages. Each directory is parsed once, so a
+// package imported from several places is shared.
+type loader struct {
+	pkgs    map[string]*Package
+	loading map[string]bool
+}
+
+func newLoader() *loader {
+	return &loader{make(map[string]*Package), make(map[string]bool)}
+}
+
+func (l *loader) load(dir string) (*Package, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if pkg, ok := l.pkgs[abs]; ok {
+		return pkg, nil
+	}
+	if l.loading[abs] {
+		return nil, fmt.Errorf("Import cycle: %s", dir)
+	}
+
+	l.loading[abs] = true
+	defer delete(l.loading, abs)
+
+	fnames, err := idlFilesInDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := parseFiles(fnames, l)
+	if err != nil {
+		return nil, err
+	}
+	l.pkgs[abs] = pkg
+	return pkg, nil
+}
+
+// visitImport parses the package imported by spec and makes it available
+// to the rest of the file being visited
+func (v *Visitor) visitImport(spec *ast.ImportSpec) {
+	pos := v.fs.Position(spec.Pos())
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err == nil && path == "time" {
+		// only imported for time.Time, an alias of the time builtin
+		v.timeImport = "time"
+		if spec.Name != nil {
+			v.timeImport = spec.Name.Name
+		}
+		return
+	}
+	if err != nil || !(strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")) {
+		msg := "'import' is only allowed for \"time\" and relative paths to IDL packages (not " + spec.Path.Value + ")"
+		v.AddErr(v.nodeErr(spec.Path, CodeInvalidImport, msg))
+		return
+	}
+
+	dir := filepath.Join(filepath.Dir(v.filename), filepath.FromSlash(path))
+	pkg, err := v.loader.load(dir)
+	if err != nil {
+		if perr, ok := err.(*Visitor); ok {
+			v.errors = append(v.errors, perr.errors...)
+			v.AddErr(v.nodeErr(spec.Path, CodeImportErrors, "Errors in imported package: "+path))
+		} else {
+			v.AddErr(v.nodeErr(spec.Path, CodeInvalidImport, err.Error()))
+		}
+		return
+	}
+	if pkg.Name == v.pkg.Name {
+		v.AddErr(v.nodeErr(spec, CodeInvalidImport, "Imported package has the same name as this package: "+pkg.Name))
+		return
+	}
+
+	name := pkg.Name
+	if spec.Name != nil {
+		name = spec.Name.Name
+		if name == "_" || name == "." {
+			v.AddErr(v.nodeErr(spec.Name, CodeInvalidImport, "Imports may not be named '"+name+"'"))
+			return
+		}
+	}
+	v.fileImports[name] = pkg
+
+	for i := 0; i < len(v.pkg.Imports); i++ {
+		imp := v.pkg.Imports[i]
+		if imp.Pkg == pkg {
+			return
+		} else if imp.Pkg.Name == pkg.Name {
+			msg := fmt.Sprintf("Imported packages %s and %s have the same name: %s",
+				imp.Path, path, pkg.Name)
+			v.AddErr(v.nodeErr(spec, CodeInvalidImport, msg))
+			return
+		}
+	}
+	v.pkg.Imports = append(v.pkg.Imports, Import{path, pkg, pos})
+}
+
+// importedType returns the PolyType for a reference to a type in an
+// imported package, such as common.Address
+func (v *Visitor) importedType(f *ast.Field, sel *ast.SelectorExpr) (PolyType, *PolyError) {
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return PolyType{}, v.nodeErr(sel, CodeUnsupportedType, "Unsupported type: "+types.ExprString(sel))
+	}
+	pkg := v.fileImports[ident.Name]
+	if pkg == nil && ident.Name == v.timeImport && sel.Sel.Name == "Time" {
+		return PolyType{GoType: "time"}, nil
+	}
+	if pkg == nil {
+		return PolyType{}, v.nodeErr(ident, CodeUnknownPackage, "Unknown package: "+ident.Name)
+	}
+	name := sel.Sel.Name
+	if pkg.FindStruct(name) == nil && pkg.FindEnum(name) == nil && pkg.FindScalar(name) == nil {
+		msg := fmt.Sprintf("Unknown type %s.%s", ident.Name, name)
+		return PolyType{}, v.nodeErr(sel, CodeUnknownType, msg)
+	}
+	return PolyType{GoType: name, Package: pkg.Name}, nil
+}
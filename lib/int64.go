@@ -0,0 +1,34 @@
+package polygenlib
+
+import "fmt"
+
+// JavaScript numbers are doubles, so int64 values above 2^53 lose
+// precision when sent as JSON numbers. A package may instead send them as
+// decimal strings, which are read as BigInt values in JavaScript:
+//
+//	//polygen:int64 string
+//	package svc
+const (
+	Int64Number = "number"
+	Int64String = "string"
+)
+
+// checkInt64Encoding checks the value of an int64 annotation
+func checkInt64Encoding(val string) error {
+	if val != Int64Number && val != Int64String {
+		return fmt.Errorf("'int64' must be %s or %s (not %s)", Int64Number, Int64String, val)
+	}
+	return nil
+}
+
+// Int64AsString returns true if the int64 values of p are sent on the
+// wire as strings
+func (p *Package) Int64AsString() bool {
+	return p.Int64Encoding == Int64String
+}
+
+// sendsInt64String returns true if t is, or is a list or map of, int64
+// values that p sends as strings
+func (p *Package) sendsInt64String(t PolyType) bool {
+	return t.GoType == "int64" && p.Int64AsString()
+}
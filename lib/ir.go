@@ -0,0 +1,229 @@
+package polygenlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"sort"
+)
+
+// IRVersion is the version of the JSON document written by MarshalIR. It
+// is incremented whenever the model changes in a way that older readers
+// can't handle.
+const IRVersion = 1
+
+// irDocument is the JSON intermediate representation of a parsed IDL
+// package. The package is encoded with the field names of the model
+// types, e.g.
+//
+//	{ "Version": 1, "Package": { "Name": "svc", "Structs": [ ... ] } }
+//
+// Imported packages are nested in the Imports of the packages that
+// import them.
+type irDocument struct {
+	Version int
+	Package *Package
+}
+
+// MarshalIR returns the JSON intermediate representation of p, which
+// ReadIR and UnmarshalIR read back in place of the IDL
+func MarshalIR(p *Package) ([]byte, error) {
+	return json.MarshalIndent(irDocument{IRVersion, p}, "", "  ")
+}
+
+// UnmarshalIR returns the package in a JSON document written by MarshalIR.
+// The document may have been edited or written by an older polygen, so
+// the package is checked as the parser checks IDL. Errors in the package
+// are returned as a *Visitor, as by Parse.
+func UnmarshalIR(data []byte) (*Package, error) {
+	doc := irDocument{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Invalid IR: %s", err)
+	}
+	if doc.Version != IRVersion {
+		return nil, fmt.Errorf("Unsupported IR version: %d (expected %d)", doc.Version, IRVersion)
+	}
+	if doc.Package == nil || doc.Package.Name == "" {
+		return nil, fmt.Errorf("Invalid IR: no package")
+	}
+	if err := shareImports(doc.Package, make(map[string]*Package)); err != nil {
+		return nil, err
+	}
+	if err := validateIR(doc.Package); err != nil {
+		return nil, err
+	}
+	return doc.Package, nil
+}
+
+// validateIR runs the parser's checks over p and the packages it imports.
+// The types of each package are checked to be well formed first, as the
+// other checks assume that every list and map has an element type.
+func validateIR(p *Package) error {
+	v := &Visitor{pkg: p, errors: make([]PolyError, 0)}
+	for _, pkg := range append(p.AllImports(), p) {
+		v.pkg = pkg
+		n := len(v.errors)
+		v.checkIRTypes()
+		v.checkIRAnnotations()
+		if len(v.errors) == n {
+			v.Validate()
+			v.CheckTypes()
+		}
+	}
+	if len(v.errors) > 0 {
+		return v
+	}
+	return nil
+}
+
+// checkIRTypes adds an error for each type in the package that is
+// malformed, or that refers to a type an imported package does not
+// declare, and for each default of a builtin type the parser would reject.
+// Types declared in the package are resolved by CheckTypes.
+func (v *Visitor) checkIRTypes() {
+	for _, s := range v.pkg.Structs {
+		for _, prop := range s.Props {
+			v.checkIRType(prop.Type, "Field "+s.Name+"."+prop.Name, prop.Pos)
+			if prop.Constraints.Default != nil && IsBuiltin(prop.Type.GoType) {
+				if _, err := defaultValue(*prop.Constraints.Default, prop.Type); err != nil {
+					msg := fmt.Sprintf("Field %s.%s: %s", s.Name, prop.Name, err)
+					v.AddErr(posErr(prop.Pos, CodeInvalidDefault, msg))
+				}
+			}
+		}
+		for _, e := range s.Embeds {
+			v.checkIRType(e.Type, "Embedded type of "+s.Name, e.Pos)
+		}
+	}
+	for _, sc := range v.pkg.Scalars {
+		if sc.Type.IsList || sc.Type.IsMap || !IsBuiltin(sc.Type.GoType) || sc.Type.GoType == "[]byte" || sc.Type.GoType == "time" {
+			msg := "Named types must be an integer, float, decimal, bool or string type (not " + sc.Type.QualifiedName() + ")"
+			v.AddErr(posErr(sc.Pos, CodeUnsupportedType, msg))
+		}
+	}
+	for _, iface := range v.pkg.Interfaces {
+		for _, m := range iface.Methods {
+			qual := iface.Name + "." + m.Name
+			for _, arg := range m.Args {
+				v.checkIRType(arg.Type, "Argument "+arg.Name+" of "+qual, arg.Pos)
+			}
+			if !m.ReturnType.IsVoid {
+				v.checkIRType(m.ReturnType, "Return type of "+qual, m.Pos)
+			}
+			for _, t := range m.Throws {
+				v.checkIRType(t, "Error type of "+qual, m.Pos)
+			}
+		}
+	}
+}
+
+// checkIRType adds an error if t, the type of what, is a list, map or set
+// with no element type, is a set or fixed length but not a list, or refers
+// to a package that is not imported or a type that the package does not
+// declare
+func (v *Visitor) checkIRType(t PolyType, what string, pos token.Position) {
+	if (t.IsSet || t.Length != 0) && !t.IsList {
+		v.AddErr(posErr(pos, CodeInvalidIR, "Invalid IR: "+what+" is a set or has a length but is not a list"))
+		return
+	}
+	if t.IsList || t.IsMap {
+		if t.Elem == nil {
+			v.AddErr(posErr(pos, CodeInvalidIR, "Invalid IR: "+what+" is a list or map with no Elem"))
+		} else {
+			v.checkIRType(*t.Elem, what, pos)
+		}
+		return
+	} else if t.Package == "" {
+		return
+	}
+	for _, imp := range v.pkg.AllImports() {
+		if imp.Name != t.Package {
+			continue
+		}
+		if imp.FindStruct(t.GoType) == nil && imp.FindEnum(t.GoType) == nil && imp.FindScalar(t.GoType) == nil {
+			v.AddErr(posErr(pos, CodeUnknownType, "Unknown type "+t.QualifiedName()))
+		}
+		return
+	}
+	v.AddErr(posErr(pos, CodeUnknownPackage, "Unknown package: "+t.Package))
+}
+
+// checkIRAnnotations adds an error for each annotation in the package that
+// the parser would reject in a doc comment
+func (v *Visitor) checkIRAnnotations() {
+	v.checkIRAnnotation("wire", v.pkg.WireCase, onPackage, "Package "+v.pkg.Name, token.Position{})
+	v.checkIRAnnotation("int64", v.pkg.Int64Encoding, onPackage, "Package "+v.pkg.Name, token.Position{})
+	for _, s := range v.pkg.Structs {
+		v.checkIRAnnotationMap(s.Annotations, onStruct, s.Name, s.Pos)
+		for _, prop := range s.Props {
+			v.checkIRAnnotationMap(prop.Annotations, onField, s.Name+"."+prop.Name, prop.Pos)
+		}
+	}
+	for _, iface := range v.pkg.Interfaces {
+		v.checkIRAnnotationMap(iface.Annotations, onInterface, iface.Name, iface.Pos)
+		for _, m := range iface.Methods {
+			v.checkIRAnnotationMap(m.Annotations, onMethod, iface.Name+"."+m.Name, m.Pos)
+		}
+	}
+	for _, e := range v.pkg.Enums {
+		v.checkIRAnnotationMap(e.Annotations, onEnum, e.Name, e.Pos)
+	}
+	for _, sc := range v.pkg.Scalars {
+		v.checkIRAnnotationMap(sc.Annotations, onEnum, sc.Name, sc.Pos)
+	}
+}
+
+// checkIRAnnotationMap checks the annotations a of what, a declaration of
+// the kind target, in key order
+func (v *Visitor) checkIRAnnotationMap(a Annotations, target annotationTarget, what string, pos token.Position) {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.checkIRAnnotation(key, a[key], target, what, pos)
+	}
+}
+
+// checkIRAnnotation adds an error if the annotation key with value val may
+// not be used on what. Package options are only checked if set.
+func (v *Visitor) checkIRAnnotation(key string, val string, target annotationTarget, what string, pos token.Position) {
+	if target == onPackage && val == "" {
+		return
+	}
+	if code, msg := checkAnnotation(key, val, target); code != "" {
+		v.AddErr(posErr(pos, code, "Invalid IR: "+what+": "+msg))
+	}
+}
+
+// ReadIR reads the JSON intermediate representation in the file fname
+func ReadIR(fname string) (*Package, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalIR(data)
+}
+
+// shareImports replaces the copies of a package imported from several
+// places with a single Package, as the parser produces. pkgs maps the
+// names of the packages already seen to the shared copy.
+func shareImports(p *Package, pkgs map[string]*Package) error {
+	for i := 0; i < len(p.Imports); i++ {
+		imp := &p.Imports[i]
+		if imp.Pkg == nil {
+			return fmt.Errorf("Invalid IR: import %s has no package", imp.Path)
+		}
+		if shared, ok := pkgs[imp.Pkg.Name]; ok {
+			imp.Pkg = shared
+			continue
+		}
+		pkgs[imp.Pkg.Name] = imp.Pkg
+		if err := shareImports(imp.Pkg, pkgs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package polygenlib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIRRoundTrip(t *testing.T) {
+	pkg, err := Parse("test.go", example1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalIR(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Version": 1`) {
+		t.Errorf("IR has no version: %s", data)
+	}
+	pkg2, err := UnmarshalIR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pkg, pkg2) {
+		t.Errorf("IR did not round trip:\n%v\n!=\n%v", pkg, pkg2)
+	}
+}
+
+func TestIRInvalid(t *testing.T) {
+	invalid := map[string]string{
+		`{"Version": 2, "Package": {"Name": "foo"}}`: "Unsupported IR version: 2",
+		`{"Version": 1}`: "Invalid IR: no package",
+		`{"Version": 1, "Package": {"Name": "foo", "Imports": [{"Path": "../bar"}]}}`: "Invalid IR: import ../bar has no package",
+		`[]`: "Invalid IR: ",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Tags", "Type": {"GoType": "string", "IsList": true}}]}]}}`: "Invalid IR: Field Person.Tags is a list or map with no Elem",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Boss", "Type": {"GoType": "Human"}}]}]}}`: "Unknown type: Human",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Home", "Type": {"GoType": "Address", "Package": "common"}}]}]}}`: "Unknown package: common",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Tags", "Type": {"GoType": "string", "IsList": true, "IsSet": true}}]}]}}`: "Invalid IR: Field Person.Tags is a list or map with no Elem",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Tags", "Type": {"GoType": "string", "IsList": true, "Length": 3}}]}]}}`: "Invalid IR: Field Person.Tags is a list or map with no Elem",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Tags", "Type": {"GoType": "string", "IsSet": true}}]}]}}`: "Invalid IR: Field Person.Tags is a set or has a length but is not a list",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Tags", "Type": {"GoType": "string", "Length": 3}}]}]}}`: "Invalid IR: Field Person.Tags is a set or has a length but is not a list",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Annotations": {"bogus": ""}}]}}`:           "Invalid IR: Person: Unknown annotation: bogus",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Annotations": {"timeout": "5s"}}]}}`:       "Invalid IR: Person: Annotation 'timeout' is not allowed on structs",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Annotations": {"error": ""}}]}}`:           "Invalid IR: Person: Annotation 'error' requires a value",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Annotations": {"error": "notanumber"}}]}}`: "Invalid IR: Person: 'error'",
+		`{"Version": 1, "Package": {"Name": "foo", "Interfaces": [{"Name": "Svc", "Methods": [` +
+			`{"Name": "Ping", "ReturnType": {"IsVoid": true}, "Annotations": {"idempotent": "yes"}}]}]}}`: "Invalid IR: Svc.Ping: Annotation 'idempotent' does not take a value",
+		`{"Version": 1, "Package": {"Name": "foo", "Structs": [{"Name": "Person", "Props": [` +
+			`{"Name": "Height", "Type": {"GoType": "float64"}, "Constraints": {"Default": "NaN"}}]}]}}`: "Field Person.Height: 'default' must be a finite number (not NaN)",
+		`{"Version": 1, "Package": {"Name": "foo", "WireCase": "kebab"}}`: "Invalid IR: Package foo: 'wire' must be",
+	}
+	dir, err := ioutil.TempDir("", "polygen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "ir.json")
+	for data, msg := range invalid {
+		_, err := UnmarshalIR([]byte(data))
+		if err == nil || !strings.HasPrefix(err.Error(), msg) {
+			t.Errorf("Unexpected error for %s: %v", data, err)
+		}
+		if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = ReadIR(fname)
+		if err == nil || !strings.HasPrefix(err.Error(), msg) {
+			t.Errorf("Unexpected error from ReadIR for %s: %v", data, err)
+		}
+	}
+}
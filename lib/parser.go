@@ -5,6 +5,12 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type scanState int
@@ -19,40 +25,210 @@ type Package struct {
 	Name       string
 	Structs    []Struct
 	Interfaces []Interface
+	Enums      []Enum
+	Scalars    []Scalar
+	Imports    []Import
+	Constants  []Constant
+	// WireCase is the case struct field names are sent in, CamelCase or
+	// SnakeCase. Empty if the IDL does not declare one.
+	WireCase string
+	// Int64Encoding is how int64 values are sent, Int64Number or
+	// Int64String. Empty if the IDL does not declare one.
+	Int64Encoding string
+}
+
+// FindStruct returns the struct with the given name, or nil if the
+// package has no such struct
+func (p *Package) FindStruct(name string) *Struct {
+	for i := 0; i < len(p.Structs); i++ {
+		if p.Structs[i].Name == name {
+			return &p.Structs[i]
+		}
+	}
+	return nil
+}
+
+// FindEnum returns the enum with the given name, or nil if the
+// package has no such enum
+func (p *Package) FindEnum(name string) *Enum {
+	for i := 0; i < len(p.Enums); i++ {
+		if p.Enums[i].Name == name {
+			return &p.Enums[i]
+		}
+	}
+	return nil
+}
+
+// UsesType returns true if any struct field, method argument, return type
+// or named scalar in p or the packages it imports has the element type
+// gotype
+func (p *Package) UsesType(gotype string) bool {
+	pkgs := append([]*Package{p}, p.AllImports()...)
+	for _, pkg := range pkgs {
+		for _, s := range pkg.Structs {
+			for _, prop := range s.Props {
+				if prop.Type.GoType == gotype {
+					return true
+				}
+			}
+		}
+		for _, iface := range pkg.Interfaces {
+			for _, m := range iface.Methods {
+				if m.ReturnType.GoType == gotype {
+					return true
+				}
+				for _, arg := range m.Args {
+					if arg.Type.GoType == gotype {
+						return true
+					}
+				}
+			}
+		}
+		for _, sc := range pkg.Scalars {
+			if sc.Type.GoType == gotype {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 type Struct struct {
 	Name  string
 	Props []Property
+	// Embeds are the anonymous struct fields of the struct. Their fields
+	// are flattened into the struct on the wire.
+	Embeds      []Embed
+	Comment     string
+	Pos         token.Position
+	Annotations Annotations
+}
+
+// Embed is a struct embedded in another struct, e.g. Person in:
+//
+//	type Employee struct {
+//		Person
+//		Salary float
+//	}
+type Embed struct {
+	Type PolyType
+	Pos  token.Position
+}
+
+// StructFields returns the fields of s, including the fields of any
+// embedded structs. Embedded fields come first, in the order the structs
+// are embedded. Fields from an imported package have their types
+// qualified with that package's name.
+func (p *Package) StructFields(s *Struct) []Property {
+	props := make([]Property, 0, len(s.Props))
+	for i := 0; i < len(s.Embeds); i++ {
+		t := s.Embeds[i].Type
+		es := p.ResolveStruct(t)
+		if es == nil {
+			continue
+		}
+		for _, prop := range p.TypePackage(t).StructFields(es) {
+			if t.Package != "" {
+				prop.Type = prop.Type.inPackage(t.Package)
+			}
+			props = append(props, prop)
+		}
+	}
+	return append(props, s.Props...)
 }
 
 type Interface struct {
-	Name    string
-	Methods []Method
+	Name        string
+	Methods     []Method
+	Comment     string
+	Pos         token.Position
+	Annotations Annotations
 }
 
 type Method struct {
-	Name       string
-	Args       []Property
-	ReturnType PolyType
+	Name        string
+	Args        []Property
+	ReturnType  PolyType
+	Comment     string
+	Pos         token.Position
+	Annotations Annotations
+	// Throws are the error types the method may fail with, declared as a
+	// second return value or with a //polygen:throws annotation
+	Throws []PolyType
+}
+
+// Enum is a named string type with a fixed set of values, declared in the
+// IDL as a "type X string" plus a const block of X typed string literals
+type Enum struct {
+	Name        string
+	Values      []EnumValue
+	Comment     string
+	Pos         token.Position
+	Annotations Annotations
+}
+
+type EnumValue struct {
+	Name    string
+	Value   string
+	Comment string
+	Pos     token.Position
 }
 
 type Property struct {
-	Name string
-	Type PolyType
+	Name        string
+	Type        PolyType
+	Comment     string
+	Constraints Constraints
+	Pos         token.Position
+	Annotations Annotations
+	// JsonName is the name of a struct field on the wire. Use WireName to
+	// read it.
+	JsonName string
 }
 
 type Visitor struct {
 	filename string
 	pkg      *Package
 	lastName string
+	lastPos  token.Position
+	lastDoc  *ast.CommentGroup
+	lastTok  token.Token
 	state    scanState
 	errors   []PolyError
 	fs       *token.FileSet
+	enumVals []enumValueDecl
+	loader   *loader
+	// fileImports maps the names of the packages imported by the file
+	// being visited to the parsed packages
+	fileImports map[string]*Package
+	// timeImport is the name the file being visited imports the Go
+	// "time" package as, or empty if it does not
+	timeImport string
+}
+
+// enumValueDecl is a const value whose enum type may not have been
+// declared yet. They are attached to their Enum in Validate.
+type enumValueDecl struct {
+	typeName string
+	value    EnumValue
+	pos      token.Position
 }
 
+// commentText returns the text of a doc comment without the comment
+// markers or surrounding whitespace. Returns an empty string if cg is nil.
+func commentText(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	return strings.TrimSpace(cg.Text())
+}
+
+// AddErr records an error. If the error has no filename, the name of the
+// file currently being visited is used.
 func (v *Visitor) AddErr(e *PolyError) {
-	e.Filename = v.filename
+	if e.Filename == "" {
+		e.Filename = v.filename
+	}
 	v.errors = append(v.errors, *e)
 }
 
@@ -60,9 +236,167 @@ func (v *Visitor) Validate() {
 	for i := 0; i < len(v.pkg.Interfaces); i++ {
 		iface := v.pkg.Interfaces[i]
 		if len(iface.Methods) == 0 {
-			v.AddErr(&PolyError{Line: 0, Message: "Interface " + iface.Name + " has zero methods"})
+			v.AddErr(posErr(iface.Pos, CodeEmptyInterface, "Interface "+iface.Name+" has zero methods"))
+		}
+		for _, m := range iface.Methods {
+			if m.Annotations.Has("notification") && !m.ReturnType.IsVoid {
+				v.AddErr(posErr(m.Pos, CodeInvalidNotification, "Notification method "+m.Name+" may not return a value"))
+			}
 		}
 	}
+
+	for _, decl := range v.enumVals {
+		e := v.pkg.FindEnum(decl.typeName)
+		if e == nil {
+			msg := "Constants must be int, float, bool, string or a string enum type (not " + decl.typeName + ")"
+			v.AddErr(posErr(decl.pos, CodeInvalidConstant, msg))
+			continue
+		}
+		for x := 0; x < len(e.Values); x++ {
+			if e.Values[x].Value == decl.value.Value {
+				msg := fmt.Sprintf("Duplicate value for enum %s: %q", e.Name, decl.value.Value)
+				v.AddErr(posErr(decl.pos, CodeDuplicateEnumValue, msg))
+			}
+		}
+		e.Values = append(e.Values, decl.value)
+	}
+
+	v.setScalars()
+	v.setWireNames()
+	v.validateEmbeds()
+}
+
+// validateEmbeds checks that embedded types are structs, that no struct
+// embeds itself, and that no struct has two fields with the same wire name
+func (v *Visitor) validateEmbeds() {
+	valid := true
+	for i := 0; i < len(v.pkg.Structs); i++ {
+		s := v.pkg.Structs[i]
+		for _, e := range s.Embeds {
+			if v.pkg.ResolveStruct(e.Type) == nil {
+				msg := "Embedded type " + e.Type.QualifiedName() + " is not a struct"
+				v.AddErr(posErr(e.Pos, CodeInvalidEmbed, msg))
+				valid = false
+			}
+		}
+	}
+	if !valid {
+		return
+	}
+
+	// cycles can only occur within this package, as import cycles
+	// are not allowed
+	state := make(map[string]int)
+	var visit func(s *Struct) bool
+	visit = func(s *Struct) bool {
+		if state[s.Name] == 1 {
+			v.AddErr(posErr(s.Pos, CodeEmbedCycle, "Struct "+s.Name+" embeds itself"))
+			return false
+		} else if state[s.Name] == 2 {
+			return true
+		}
+		state[s.Name] = 1
+		for _, e := range s.Embeds {
+			if e.Type.Package == "" && !visit(v.pkg.FindStruct(e.Type.GoType)) {
+				return false
+			}
+		}
+		state[s.Name] = 2
+		return true
+	}
+	for i := 0; i < len(v.pkg.Structs); i++ {
+		if !visit(&v.pkg.Structs[i]) {
+			return
+		}
+	}
+
+	v.checkWireNames()
+}
+
+// parseTag parses the tag of a struct field of type t, returning its
+// constraints and wire name. Errors are added to the visitor.
+func (v *Visitor) parseTag(tag *ast.BasicLit, t PolyType) (Constraints, string) {
+	s, err := strconv.Unquote(tag.Value)
+	if err != nil {
+		v.AddErr(v.nodeErr(tag, CodeInvalidTag, "Invalid tag: "+tag.Value))
+		return Constraints{}, ""
+	}
+	c, err := ParseConstraints(s, t)
+	if err != nil {
+		v.AddErr(v.nodeErr(tag, CodeInvalidTag, err.Error()))
+		return c, ""
+	}
+	name, err := jsonTagName(s)
+	if err != nil {
+		v.AddErr(v.nodeErr(tag, CodeInvalidTag, err.Error()))
+	}
+	return c, name
+}
+
+// visitEmbed records an anonymous field of the struct being visited
+func (v *Visitor) visitEmbed(f *ast.Field) {
+	s := &v.pkg.Structs[len(v.pkg.Structs)-1]
+	pos := v.fs.Position(f.Pos())
+	if _, ok := f.Type.(*ast.StarExpr); ok {
+		v.AddErr(v.nodeErr(f.Type, CodeInvalidEmbed, "Embedded types may not be pointers"))
+		return
+	}
+	if f.Tag != nil {
+		v.AddErr(v.nodeErr(f.Tag, CodeInvalidEmbed, "Embedded types may not have tags"))
+		return
+	}
+	ptype, err := newNamedPolyType(v, f, f.Type)
+	if err != nil {
+		v.AddErr(err)
+		return
+	}
+	s.Embeds = append(s.Embeds, Embed{ptype, pos})
+}
+
+// visitConst records the values of a const spec. Untyped consts, and
+// consts typed with a builtin, are package constants. Otherwise each const
+// must be typed with a string enum type and have a string literal value.
+func (v *Visitor) visitConst(spec *ast.ValueSpec) {
+	pos := v.fs.Position(spec.Pos())
+	doc := spec.Doc
+	if doc == nil {
+		doc = v.lastDoc
+	}
+	if doc == nil {
+		doc = spec.Comment
+	}
+	if spec.Type == nil {
+		v.visitConstant(spec, doc)
+		return
+	}
+	ident, ok := spec.Type.(*ast.Ident)
+	if !ok {
+		v.AddErr(v.nodeErr(spec.Type, CodeInvalidConstant, "Constants must be int, float, bool, string or a string enum type"))
+		return
+	}
+	if constantTypes[ident.Name] {
+		v.visitConstant(spec, doc)
+		return
+	}
+	if len(spec.Values) != len(spec.Names) {
+		v.AddErr(v.nodeErr(spec, CodeInvalidEnumValue, "Enum values must be string literals"))
+		return
+	}
+
+	for i := 0; i < len(spec.Names); i++ {
+		lit, ok := spec.Values[i].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			v.AddErr(v.nodeErr(spec.Values[i], CodeInvalidEnumValue, "Enum values must be string literals"))
+			continue
+		}
+		val, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			v.AddErr(v.nodeErr(lit, CodeInvalidEnumValue, "Invalid string literal: "+lit.Value))
+			continue
+		}
+		ev := EnumValue{spec.Names[i].Name, val, commentText(doc), v.fs.Position(spec.Names[i].Pos())}
+		v.enumVals = append(v.enumVals, enumValueDecl{ident.Name, ev, pos})
+	}
 }
 
 func (v Visitor) Error() string {
@@ -76,85 +410,192 @@ func (v Visitor) Error() string {
 	return err
 }
 
+// PolyType is the type of a struct field, method argument or return
+// value. Lists and maps are described recursively by Elem, the type of
+// their values. GoType and Package always name the innermost element
+// type, so for map[string][]Person GoType is "Person".
+//
+// Sets, declared as map[T]struct{}, are lists of unique values and are
+// sent on the wire as JSON arrays. Fixed length arrays, such as [4]int,
+// are lists with a Length.
 type PolyType struct {
 	GoType     string
 	MapKeyType string
 	IsVoid     bool
 	IsMap      bool
 	IsList     bool
+	IsSet      bool
+	// Length is the number of values in a fixed length array, and 0 for
+	// other lists
+	Length int
+	// Elem is the type of the values of a list or map, and nil otherwise
+	Elem *PolyType
+	// IsOptional is true for pointer types, which may be null or
+	// missing on the wire
+	IsOptional bool
+	// Package is the name of the imported package that declares GoType,
+	// or empty for builtins and types declared in the current package
+	Package string
+}
+
+// QualifiedName returns the element type name, prefixed with its
+// package name if it was imported
+func (t PolyType) QualifiedName() string {
+	if t.Package != "" {
+		return t.Package + "." + t.GoType
+	}
+	return t.GoType
+}
+
+// IsBuiltin returns true if gotype is one of the builtin IDL types.
+// Binary data is declared as []byte, and sent on the wire as a base64
+// encoded string. Timestamps are declared as time (or time.Time), and sent
+// as RFC 3339 strings. Arbitrary precision numbers, such as amounts of
+// money, are declared as decimal, and sent as strings such as "-12.50".
+func IsBuiltin(gotype string) bool {
+	switch gotype {
+	case "bool", "string", "[]byte", "time", "decimal":
+		return true
+	}
+	return isInteger(gotype) || isFloat(gotype)
+}
+
+// isInteger returns true if gotype is int, or an integer with an explicit
+// width. int is 64 bits wide.
+func isInteger(gotype string) bool {
+	return gotype == "int" || gotype == "int32" || gotype == "int64"
+}
+
+// isFloat returns true if gotype is float, or a float with an explicit
+// width. float is 64 bits wide.
+func isFloat(gotype string) bool {
+	return gotype == "float" || gotype == "float32" || gotype == "float64"
+}
+
+// bitSize returns the width in bits of the integer or float type gotype
+func bitSize(gotype string) int {
+	if strings.HasSuffix(gotype, "32") {
+		return 32
+	}
+	return 64
 }
 
 func NewVoidPolyType() PolyType {
-	return PolyType{"", "", true, false, false}
+	return PolyType{IsVoid: true}
 }
 
 func NewPolyTypeFromField(v *Visitor, f *ast.Field) (PolyType, *PolyError) {
-	switch t := f.Type.(type) {
+	if star, ok := f.Type.(*ast.StarExpr); ok {
+		if _, ok := star.X.(*ast.StarExpr); ok {
+			return PolyType{}, v.nodeErr(star, CodeIllegalType, "Pointers to pointers are not allowed")
+		}
+		ptype, err := newPolyTypeFromExpr(v, f, star.X)
+		ptype.IsOptional = true
+		return ptype, err
+	}
+	return newPolyTypeFromExpr(v, f, f.Type)
+}
+
+func newPolyTypeFromExpr(v *Visitor, f *ast.Field, expr ast.Expr) (PolyType, *PolyError) {
+	switch t := expr.(type) {
 	case *ast.MapType:
-		kname := fmt.Sprintf("%v", t.Key)
-		vname := fmt.Sprintf("%v", t.Value)
-		if kname == "string" {
-			if _, ok := t.Value.(*ast.MapType); ok {
-				line := v.fs.Position(f.Pos()).Line
-				return PolyType{}, &PolyError{Line: line, Message: "Maps may not be nested"}
-			} else {
-				return PolyType{vname, kname, false, true, false}, nil
-			}
-		} else {
-			line := v.fs.Position(f.Pos()).Line
-			return PolyType{}, &PolyError{Line: line, Message: "Map keys must be type string (not " + kname + ")"}
+		if st, ok := t.Value.(*ast.StructType); ok && len(st.Fields.List) == 0 {
+			elem, err := newNamedPolyType(v, f, t.Key)
+			ptype := PolyType{GoType: elem.GoType, Package: elem.Package, IsList: true, IsSet: true, Elem: &elem}
+			return ptype, err
+		}
+		kname := types.ExprString(t.Key)
+		if kname != "string" {
+			return PolyType{}, v.nodeErr(t.Key, CodeInvalidMapKey, "Map keys must be type string (not "+kname+")")
 		}
+		if _, ok := t.Value.(*ast.StarExpr); ok {
+			return PolyType{}, v.nodeErr(t.Value, CodeIllegalType, "Map values may not be pointers")
+		}
+		elem, err := newPolyTypeFromExpr(v, f, t.Value)
+		ptype := PolyType{GoType: elem.GoType, Package: elem.Package, MapKeyType: kname, IsMap: true, Elem: &elem}
+		return ptype, err
 	case *ast.ArrayType:
-		tname := fmt.Sprintf("%v", t.Elt)
-		return PolyType{tname, "", false, false, true}, nil
-	case *ast.SliceExpr:
-		tname := fmt.Sprintf("%v", t.X)
-		return PolyType{tname, "", false, false, true}, nil
-	default:
-		stype := fmt.Sprintf("%v", t)
-		switch stype {
-		case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64",
-			"float32", "float64", "complex64", "complex128", "byte", "uint", "uintptr":
-			line := v.fs.Position(f.Pos()).Line
-			return PolyType{}, &PolyError{Line: line, Message: "Illegal type: " + stype}
-		default:
-			if _, ok := t.(*ast.Ellipsis); ok {
-				line := v.fs.Position(f.Pos()).Line
-				return PolyType{}, &PolyError{Line: line, Message: "Variadics are not allowed. Use [] instead"}
+		if ident, ok := t.Elt.(*ast.Ident); ok && ident.Name == "byte" && t.Len == nil {
+			return PolyType{GoType: "[]byte"}, nil
+		}
+		if _, ok := t.Elt.(*ast.StarExpr); ok {
+			return PolyType{}, v.nodeErr(t.Elt, CodeIllegalType, "List elements may not be pointers")
+		}
+		length := 0
+		if t.Len != nil {
+			lit, ok := t.Len.(*ast.BasicLit)
+			if ok && lit.Kind == token.INT {
+				n, err := strconv.ParseInt(lit.Value, 0, 32)
+				if err == nil {
+					length = int(n)
+				}
+			}
+			if length <= 0 {
+				msg := "Array length must be a positive integer (not " + types.ExprString(t.Len) + ")"
+				return PolyType{}, v.nodeErr(t.Len, CodeInvalidArrayLength, msg)
 			}
 		}
-		//fmt.Printf("NewPoly. type: %v\n", reflect.TypeOf(t))
+		elem, err := newPolyTypeFromExpr(v, f, t.Elt)
+		ptype := PolyType{GoType: elem.GoType, Package: elem.Package, IsList: true, Length: length, Elem: &elem}
+		return ptype, err
 	}
-
-	tname := fmt.Sprintf("%v", f.Type)
-	return PolyType{tname, "", false, false, false}, nil
+	return newNamedPolyType(v, f, expr)
 }
 
-func NewPolyTypeFromGoType(gotype string) (PolyType, *PolyError) {
-	return PolyType{gotype, "", false, false, false}, nil
-}
-
-type PolyError struct {
-	Filename string
-	Line     int
-	Message  string
+// newNamedPolyType returns the PolyType for a builtin, a type declared in
+// the IDL, or a type from an imported package
+func newNamedPolyType(v *Visitor, f *ast.Field, expr ast.Expr) (PolyType, *PolyError) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "int8", "int16", "uint8", "uint16", "uint32", "uint64",
+			"complex64", "complex128", "byte", "uint", "uintptr":
+			return PolyType{}, v.nodeErr(t, CodeIllegalType, "Illegal type: "+t.Name)
+		}
+		return PolyType{GoType: t.Name}, nil
+	case *ast.SelectorExpr:
+		return v.importedType(f, t)
+	case *ast.Ellipsis:
+		return PolyType{}, v.nodeErr(t, CodeIllegalType, "Variadics are not allowed. Use [] instead")
+	}
+	return PolyType{}, v.nodeErr(expr, CodeUnsupportedType, "Unsupported type: "+types.ExprString(expr))
 }
 
-func (e PolyError) Error() string {
-	return fmt.Sprintf("%s:%d: %s", e.Filename, e.Line, e.Message)
+func NewPolyTypeFromGoType(gotype string) (PolyType, *PolyError) {
+	return PolyType{GoType: gotype}, nil
 }
 
 func (v *Visitor) Visit(n ast.Node) ast.Visitor {
 	//fmt.Printf("  node: type=%v, value=%v\n", reflect.TypeOf(n), n)
 	switch t := n.(type) {
+	case *ast.GenDecl:
+		v.lastTok = t.Tok
+		v.lastDoc = nil
+		if !t.Lparen.IsValid() {
+			v.lastDoc = t.Doc
+		}
 	case *ast.TypeSpec:
 		v.lastName = t.Name.Name
+		v.lastPos = v.fs.Position(t.Name.Pos())
+		if t.Doc != nil {
+			v.lastDoc = t.Doc
+		}
+		if ident, ok := t.Type.(*ast.Ident); ok {
+			v.visitNamedType(t, ident)
+		}
 	case *ast.StructType:
-		s := Struct{v.lastName, []Property{}}
+		s := Struct{Name: v.lastName, Props: []Property{}, Comment: commentText(v.lastDoc), Pos: v.lastPos,
+			Annotations: v.parseAnnotations(v.lastDoc, onStruct)}
 		v.pkg.Structs = append(v.pkg.Structs, s)
 		v.state = STRUCT
+		for _, f := range t.Fields.List {
+			if len(f.Names) == 0 {
+				v.visitEmbed(f)
+			}
+		}
 	case *ast.InterfaceType:
-		i := Interface{v.lastName, []Method{}}
+		i := Interface{v.lastName, []Method{}, commentText(v.lastDoc), v.lastPos,
+			v.parseAnnotations(v.lastDoc, onInterface)}
 		v.pkg.Interfaces = append(v.pkg.Interfaces, i)
 		v.state = INTERFACE
 	case *ast.FieldList:
@@ -170,21 +611,20 @@ func (v *Visitor) Visit(n ast.Node) ast.Visitor {
 							ptype, err := NewPolyTypeFromField(v, fields[x])
 							if err == nil {
 								fname := fields[x].Names[0].Name
-								prop := Property{fname, ptype}
+								pos := v.fs.Position(fields[x].Names[0].Pos())
+								prop := Property{fname, ptype, "", Constraints{}, pos, nil, ""}
 								meth.Args = append(meth.Args, prop)
 							} else {
 								v.AddErr(err)
 							}
 						} else {
-							line := v.fs.Position(n.Pos()).Line
-							v.AddErr(&PolyError{Line: line, Message: "Method arguments must have variable names"})
+							v.AddErr(v.nodeErr(fields[x], CodeInvalidMethod, "Method arguments must have variable names"))
 						}
 					}
 				} else {
 					if len(fields) > 0 {
-						if len(fields) > 1 {
-							line := v.fs.Position(n.Pos()).Line
-							v.AddErr(&PolyError{Line: line, Message: "Methods may only return one value"})
+						if len(fields) > 2 || len(fields[0].Names) > 1 {
+							v.AddErr(v.nodeErr(t, CodeInvalidMethod, "Methods may only return one value and one error"))
 						} else {
 							rtype, err := NewPolyTypeFromField(v, fields[0])
 							if err == nil {
@@ -192,6 +632,9 @@ func (v *Visitor) Visit(n ast.Node) ast.Visitor {
 							} else {
 								v.AddErr(err)
 							}
+							if len(fields) == 2 {
+								v.visitMethodError(meth, fields[1])
+							}
 						}
 					}
 				}
@@ -206,7 +649,17 @@ func (v *Visitor) Visit(n ast.Node) ast.Visitor {
 				tmp := &v.pkg.Structs[len(v.pkg.Structs)-1]
 				ptype, err := NewPolyTypeFromField(v, t)
 				if err == nil {
-					tmp.Props = append(tmp.Props, Property{t.Names[0].Name, ptype})
+					doc := t.Doc
+					if doc == nil {
+						doc = t.Comment
+					}
+					pos := v.fs.Position(t.Names[0].Pos())
+					prop := Property{t.Names[0].Name, ptype, commentText(doc), Constraints{}, pos,
+						v.parseAnnotations(doc, onField), ""}
+					if t.Tag != nil {
+						prop.Constraints, prop.JsonName = v.parseTag(t.Tag, ptype)
+					}
+					tmp.Props = append(tmp.Props, prop)
 				} else {
 					v.AddErr(err)
 				}
@@ -215,50 +668,146 @@ func (v *Visitor) Visit(n ast.Node) ast.Visitor {
 		case INTERFACE:
 			if len(t.Names) > 0 {
 				tmp := &v.pkg.Interfaces[len(v.pkg.Interfaces)-1]
-				m := Method{t.Names[0].Name, nil, NewVoidPolyType()}
+				doc := t.Doc
+				if doc == nil {
+					doc = t.Comment
+				}
+				pos := v.fs.Position(t.Names[0].Pos())
+				m := Method{t.Names[0].Name, nil, NewVoidPolyType(), commentText(doc), pos,
+					v.parseAnnotations(doc, onMethod), nil}
+				v.visitThrows(&m)
 				tmp.Methods = append(tmp.Methods, m)
 			}
 
 		}
 	case *ast.ImportSpec:
-		line := v.fs.Position(n.Pos()).Line
-		v.AddErr(&PolyError{Line: line, Message: "'import' is not allowed"})
+		v.visitImport(t)
+		return nil
 	case *ast.ValueSpec:
-		line := v.fs.Position(n.Pos()).Line
-		v.AddErr(&PolyError{Line: line, Message: "Values are not allowed"})
+		if v.lastTok == token.CONST {
+			v.visitConst(t)
+		} else {
+			v.AddErr(v.nodeErr(t, CodeNotAllowed, "Values are not allowed"))
+		}
+		return nil
 	case *ast.FuncType:
 		if v.state != INTERFACE {
-			line := v.fs.Position(n.Pos()).Line
-			v.AddErr(&PolyError{Line: line, Message: "Functions are not allowed"})
+			v.AddErr(v.nodeErr(t, CodeNotAllowed, "Functions are not allowed"))
 		}
 	}
 	return v
 }
 
+// Parse parses a single IDL file
 func Parse(fname string, code string) (*Package, error) {
-	//lines = strings.Split(code, "\n")
-	//for i := 0; i < len(lines); i++ {
-	//	f.AddLine(i+1, 
-	//}
-	fs := &token.FileSet{}
-	fs.AddFile(fname, 0, len(code))
-	af, err := parser.ParseFile(fs, fname, code, 0)
+	return ParseSources([]File{File{fname, []byte(code)}})
+}
+
+// ParseFiles reads and parses a list of IDL files that share a package
+// clause into a single Package
+func ParseFiles(fnames []string) (*Package, error) {
+	return parseFiles(fnames, newLoader())
+}
+
+func parseFiles(fnames []string, l *loader) (*Package, error) {
+	files := make([]File, 0)
+	for i := 0; i < len(fnames); i++ {
+		code, err := ioutil.ReadFile(fnames[i])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{fnames[i], code})
+	}
+	return parseSources(files, l)
+}
+
+// ParseDir parses all .go files in dir into a single Package. Test files
+// (_test.go) are ignored.
+func ParseDir(dir string) (*Package, error) {
+	fnames, err := idlFilesInDir(dir)
 	if err != nil {
 		return nil, err
 	}
+	return ParseFiles(fnames)
+}
 
-	//fmt.Printf("err=%v\n", err)
-	//fmt.Printf("ast=%v\n", af)
+// idlFilesInDir returns the sorted names of the IDL files in dir
+func idlFilesInDir(dir string) ([]string, error) {
+	fnames, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	idlFiles := make([]string, 0)
+	for i := 0; i < len(fnames); i++ {
+		if !strings.HasSuffix(fnames[i], "_test.go") {
+			idlFiles = append(idlFiles, fnames[i])
+		}
+	}
+	if len(idlFiles) == 0 {
+		return nil, fmt.Errorf("No .go files found in: %s", dir)
+	}
+	sort.Strings(idlFiles)
+	return idlFiles, nil
+}
+
+// ParseSources parses IDL source files into a single Package. Types
+// declared in one file may be referenced from any other. Each File has the
+// name of the source file and its contents. Imported packages are found
+// relative to the directory of the importing file.
+func ParseSources(files []File) (*Package, error) {
+	return parseSources(files, newLoader())
+}
+
+func parseSources(files []File, l *loader) (*Package, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No IDL files given")
+	}
 
-	v := &Visitor{fname, &Package{}, "", STRUCT, make([]PolyError, 0), fs}
-	v.pkg.Name = af.Name.Name
+	fs := token.NewFileSet()
+	v := &Visitor{"", &Package{}, "", token.Position{}, nil, token.ILLEGAL, STRUCT,
+		make([]PolyError, 0), fs, nil, l, nil, ""}
 	v.pkg.Structs = []Struct{}
 	v.pkg.Interfaces = []Interface{}
-	ast.Walk(v, af)
+	v.pkg.Enums = []Enum{}
+	v.pkg.Scalars = []Scalar{}
+	v.pkg.Imports = []Import{}
+
+	syntaxErrs := false
+	for i := 0; i < len(files); i++ {
+		fname := files[i].Name
+		af, err := parser.ParseFile(fs, fname, files[i].Contents, parser.ParseComments)
+		if err != nil {
+			v.addSyntaxErrors(err)
+			syntaxErrs = true
+			continue
+		}
+
+		v.filename = fname
+		v.state = STRUCT
+		v.fileImports = make(map[string]*Package)
+		v.timeImport = ""
+		if v.pkg.Name == "" {
+			v.pkg.Name = af.Name.Name
+		} else if af.Name.Name != v.pkg.Name {
+			msg := fmt.Sprintf("Package %s does not match package %s in %s",
+				af.Name.Name, v.pkg.Name, files[0].Name)
+			v.AddErr(v.nodeErr(af.Name, CodePackageMismatch, msg))
+		}
+		v.visitPackageAnnotations(af)
+		ast.Walk(v, af)
+	}
+
+	if syntaxErrs {
+		// types can't be checked if any file failed to parse
+		setAllErrorEnds(v.errors, files)
+		return nil, v
+	}
 
 	v.Validate()
+	v.CheckTypes()
 
 	if len(v.errors) > 0 {
+		setAllErrorEnds(v.errors, files)
 		return nil, v
 	}
 	return v.pkg, nil
@@ -1,6 +1,10 @@
 package polygenlib
 
 import (
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -30,49 +34,93 @@ type SampleService interface {
     getPeople(params map[string] string) []Person
 }`
 
+// clearPositions zeroes the source positions in pkg so that it can be
+// compared with an expected Package
+func clearPositions(pkg *Package) {
+	for i := 0; i < len(pkg.Structs); i++ {
+		s := &pkg.Structs[i]
+		s.Pos = token.Position{}
+		for x := 0; x < len(s.Props); x++ {
+			s.Props[x].Pos = token.Position{}
+		}
+	}
+	for i := 0; i < len(pkg.Interfaces); i++ {
+		iface := &pkg.Interfaces[i]
+		iface.Pos = token.Position{}
+		for x := 0; x < len(iface.Methods); x++ {
+			m := &iface.Methods[x]
+			m.Pos = token.Position{}
+			for y := 0; y < len(m.Args); y++ {
+				m.Args[y].Pos = token.Position{}
+			}
+		}
+	}
+	for i := 0; i < len(pkg.Enums); i++ {
+		e := &pkg.Enums[i]
+		e.Pos = token.Position{}
+		for x := 0; x < len(e.Values); x++ {
+			e.Values[x].Pos = token.Position{}
+		}
+	}
+	for i := 0; i < len(pkg.Constants); i++ {
+		pkg.Constants[i].Pos = token.Position{}
+	}
+	for i := 0; i < len(pkg.Scalars); i++ {
+		pkg.Scalars[i].Pos = token.Position{}
+	}
+}
+
 func TestParseExample(t *testing.T) {
 	pkg, err := Parse("test.go", example1)
 	if err != nil {
 		t.Fatal(err)
 	}
+	clearPositions(pkg)
 
-	intType := PolyType{"int", "", false, false, false}
-	floatType := PolyType{"float", "", false, false, false}
-	stringType := PolyType{"string", "", false, false, false}
-	boolType := PolyType{"bool", "", false, false, false}
-	personType := PolyType{"Person", "", false, false, false}
-	resultType := PolyType{"Result", "", false, false, false}
+	intType := PolyType{GoType: "int"}
+	floatType := PolyType{GoType: "float"}
+	stringType := PolyType{GoType: "string"}
+	boolType := PolyType{GoType: "bool"}
+	personType := PolyType{GoType: "Person"}
+	resultType := PolyType{GoType: "Result"}
 
 	structs := []Struct{
-		Struct{"Result", []Property{
-			Property{"Success", boolType},
-			Property{"Code", intType},
-			Property{"Note", stringType},
+		Struct{Name: "Result", Props: []Property{
+			Property{Name: "Success", Type: boolType, JsonName: "success"},
+			Property{Name: "Code", Type: intType, JsonName: "code"},
+			Property{Name: "Note", Type: stringType, JsonName: "note"},
 		}},
-		Struct{"Person", []Property{
-			Property{"Id", intType},
-			Property{"name", stringType},
-			Property{"email", stringType},
-			Property{"title", stringType},
-			Property{"age", floatType},
+		Struct{Name: "Person", Props: []Property{
+			Property{Name: "Id", Type: intType, JsonName: "id"},
+			Property{Name: "name", Type: stringType, JsonName: "name"},
+			Property{Name: "email", Type: stringType,
+				Constraints: Constraints{Pattern: "\\S+@\\S+.\\S+"}, JsonName: "email"},
+			Property{Name: "title", Type: stringType, JsonName: "title"},
+			Property{Name: "age", Type: floatType, JsonName: "age"},
 		}},
 	}
 	ifaces := []Interface{
-		Interface{"SampleService", []Method{
-			Method{"Create", []Property{Property{"p", personType}},
-				resultType},
-			Method{"Add", []Property{Property{"a", intType},
-				Property{"b", intType}}, intType},
-			Method{"StoreName", []Property{Property{"name", stringType}},
-				NewVoidPolyType()},
-			Method{"Say_Hi", []Property{}, stringType},
-			Method{"getPeople", []Property{
-				Property{"params",
-					PolyType{"string", "string", false, true, false}},
-			}, PolyType{"Person", "", false, false, true}},
+		Interface{Name: "SampleService", Methods: []Method{
+			Method{Name: "Create",
+				Args:       []Property{Property{Name: "p", Type: personType}},
+				ReturnType: resultType},
+			Method{Name: "Add",
+				Args: []Property{Property{Name: "a", Type: intType},
+					Property{Name: "b", Type: intType}},
+				ReturnType: intType},
+			Method{Name: "StoreName",
+				Args:       []Property{Property{Name: "name", Type: stringType}},
+				ReturnType: NewVoidPolyType()},
+			Method{Name: "Say_Hi", Args: []Property{}, ReturnType: stringType},
+			Method{Name: "getPeople",
+				Args: []Property{
+					Property{Name: "params",
+						Type: PolyType{GoType: "string", MapKeyType: "string", IsMap: true, Elem: &stringType}},
+				},
+				ReturnType: PolyType{GoType: "Person", IsList: true, Elem: &personType}},
 		}},
 	}
-	expected := Package{"foolib", structs, ifaces}
+	expected := Package{Name: "foolib", Structs: structs, Interfaces: ifaces}
 	if !reflect.DeepEqual(expected.Structs, pkg.Structs) {
 		t.Errorf("%v != %v", expected.Structs, pkg.Structs)
 	}
@@ -81,6 +129,691 @@ func TestParseExample(t *testing.T) {
 	}
 }
 
+var commentIdl = `package foo
+
+// Person is someone
+// we know
+type Person struct {
+	// Name is their full name
+	Name string
+	Age  int // in years
+}
+
+type (
+	// Grouped docs
+	Result struct {
+		Ok bool
+	}
+)
+
+// PersonService manages people
+type PersonService interface {
+	// Create stores p
+	Create(p Person) Result
+	Count() int
+}`
+
+func TestParseComments(t *testing.T) {
+	pkg, err := Parse("test.go", commentIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := pkg.Structs[0]
+	if p.Comment != "Person is someone\nwe know" {
+		t.Errorf("Unexpected struct comment: %q", p.Comment)
+	}
+	if p.Props[0].Comment != "Name is their full name" {
+		t.Errorf("Unexpected field comment: %q", p.Props[0].Comment)
+	}
+	if p.Props[1].Comment != "in years" {
+		t.Errorf("Unexpected trailing field comment: %q", p.Props[1].Comment)
+	}
+	if pkg.Structs[1].Comment != "Grouped docs" {
+		t.Errorf("Unexpected grouped struct comment: %q", pkg.Structs[1].Comment)
+	}
+
+	iface := pkg.Interfaces[0]
+	if iface.Comment != "PersonService manages people" {
+		t.Errorf("Unexpected interface comment: %q", iface.Comment)
+	}
+	if iface.Methods[0].Comment != "Create stores p" {
+		t.Errorf("Unexpected method comment: %q", iface.Methods[0].Comment)
+	}
+	if iface.Methods[1].Comment != "" {
+		t.Errorf("Expected empty method comment, got: %q", iface.Methods[1].Comment)
+	}
+}
+
+var enumIdl = `package foo
+
+// Status of an account
+type Status string
+
+const (
+	// Active accounts can log in
+	Active   Status = "active"
+	Disabled Status = "disabled"
+)
+
+type Account struct {
+	State Status
+}
+
+const Closed Status = "closed"
+`
+
+func TestParseEnum(t *testing.T) {
+	pkg, err := Parse("test.go", enumIdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pkg.Enums) != 1 {
+		t.Fatalf("Expected 1 enum, got: %v", pkg.Enums)
+	}
+	e := pkg.Enums[0]
+	if e.Name != "Status" || e.Comment != "Status of an account" || e.Pos.Line != 4 {
+		t.Errorf("Unexpected enum: %v", e)
+	}
+	if pos := e.Values[1].Pos; pos.Line != 9 || pos.Column != 2 {
+		t.Errorf("Unexpected enum value position: %v", pos)
+	}
+	clearPositions(pkg)
+	e = pkg.Enums[0]
+	values := []EnumValue{
+		EnumValue{"Active", "active", "Active accounts can log in", token.Position{}},
+		EnumValue{"Disabled", "disabled", "", token.Position{}},
+		EnumValue{"Closed", "closed", "", token.Position{}},
+	}
+	if !reflect.DeepEqual(values, e.Values) {
+		t.Errorf("%v != %v", values, e.Values)
+	}
+	if pkg.FindEnum("Status") == nil || pkg.FindEnum("Account") != nil {
+		t.Error("FindEnum returned wrong result")
+	}
+}
+
+func TestParseScalars(t *testing.T) {
+	idl := `package foo
+
+// UserId identifies a user
+type UserId string
+
+type Cents int
+
+type Role string
+
+const Admin Role = "admin"
+
+type User struct {
+	Id UserId
+	Balance Cents
+	Friends map[UserId]struct{}
+}`
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := pkg.Scalars[0].Pos; pos.Line != 4 || pos.Column != 6 {
+		t.Errorf("Unexpected scalar position: %v", pos)
+	}
+	clearPositions(pkg)
+	scalars := []Scalar{
+		Scalar{"UserId", PolyType{GoType: "string"}, "UserId identifies a user", token.Position{}, nil},
+		Scalar{"Cents", PolyType{GoType: "int"}, "", token.Position{}, nil},
+	}
+	if !reflect.DeepEqual(scalars, pkg.Scalars) {
+		t.Errorf("%v != %v", scalars, pkg.Scalars)
+	}
+	if len(pkg.Enums) != 1 || pkg.Enums[0].Name != "Role" {
+		t.Errorf("Unexpected enums: %v", pkg.Enums)
+	}
+	if pkg.ResolveScalar(pkg.Structs[0].Props[0].Type) != &pkg.Scalars[0] {
+		t.Error("ResolveScalar returned wrong result")
+	}
+
+	_, err = Parse("test.go", "package foo\n\ntype Cents uint64")
+	if err == nil || err.Error() != "test.go:3: Named types must be an integer, float, decimal, bool or string type (not uint64)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	_, err = Parse("test.go", "package foo\n\ntype Cents int\n\ntype User struct {\n Balance Cents `default:0`\n}")
+	if err == nil || err.Error() != "test.go:6: Field User.Balance: 'default' may only be used on int, float, bool, string and enum fields" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseOptional(t *testing.T) {
+	idl := `package foo
+type Person struct {
+	Nickname *string
+	Boss     *Person
+	Tags     *[]string
+}
+
+type PersonService interface {
+	Find(id int, name *string) *Person
+}`
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearPositions(pkg)
+
+	expected := []Property{
+		Property{Name: "Nickname", Type: PolyType{GoType: "string", IsOptional: true}, JsonName: "nickname"},
+		Property{Name: "Boss", Type: PolyType{GoType: "Person", IsOptional: true}, JsonName: "boss"},
+		Property{Name: "Tags", Type: PolyType{GoType: "string", IsList: true, IsOptional: true, Elem: &PolyType{GoType: "string"}}, JsonName: "tags"},
+	}
+	if !reflect.DeepEqual(expected, pkg.Structs[0].Props) {
+		t.Errorf("%v != %v", expected, pkg.Structs[0].Props)
+	}
+
+	m := pkg.Interfaces[0].Methods[0]
+	if m.Args[0].Type.IsOptional || !m.Args[1].Type.IsOptional {
+		t.Errorf("Unexpected args: %v", m.Args)
+	}
+	if !reflect.DeepEqual(PolyType{GoType: "Person", IsOptional: true}, m.ReturnType) {
+		t.Errorf("Unexpected return type: %v", m.ReturnType)
+	}
+}
+
+func TestParseEmbed(t *testing.T) {
+	idl := `package foo
+
+type Base struct {
+	Id string "required"
+}
+
+type Person struct {
+	Base
+	Name string
+}
+
+type Employee struct {
+	Person
+	Salary float
+}`
+	pkg, err := Parse("embed.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emp := pkg.FindStruct("Employee")
+	if len(emp.Embeds) != 1 || emp.Embeds[0].Type.GoType != "Person" || emp.Embeds[0].Pos.Line != 13 {
+		t.Errorf("Unexpected embeds: %v", emp.Embeds)
+	}
+	if len(emp.Props) != 1 {
+		t.Errorf("Embedded fields should not be in Props: %v", emp.Props)
+	}
+	names := make([]string, 0)
+	for _, prop := range pkg.StructFields(emp) {
+		names = append(names, prop.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Id", "Name", "Salary"}) {
+		t.Errorf("Unexpected fields: %v", names)
+	}
+	if !pkg.StructFields(emp)[0].Constraints.Required {
+		t.Errorf("Embedded field lost its constraints")
+	}
+}
+
+func TestParseNested(t *testing.T) {
+	idl := `package foo
+
+type Person struct {
+	Groups map[string][]Person
+	Grid [][]float
+}
+
+type Svc interface {
+	Counts() []map[string]int
+}`
+	pkg, err := Parse("nested.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	person := PolyType{GoType: "Person"}
+	float := PolyType{GoType: "float"}
+	intType := PolyType{GoType: "int"}
+	groups := PolyType{GoType: "Person", MapKeyType: "string", IsMap: true,
+		Elem: &PolyType{GoType: "Person", IsList: true, Elem: &person}}
+	grid := PolyType{GoType: "float", IsList: true,
+		Elem: &PolyType{GoType: "float", IsList: true, Elem: &float}}
+	counts := PolyType{GoType: "int", IsList: true,
+		Elem: &PolyType{GoType: "int", MapKeyType: "string", IsMap: true, Elem: &intType}}
+
+	props := pkg.Structs[0].Props
+	if !reflect.DeepEqual(props[0].Type, groups) {
+		t.Errorf("Unexpected type: %v", props[0].Type)
+	}
+	if !reflect.DeepEqual(props[1].Type, grid) {
+		t.Errorf("Unexpected type: %v", props[1].Type)
+	}
+	if !reflect.DeepEqual(pkg.Interfaces[0].Methods[0].ReturnType, counts) {
+		t.Errorf("Unexpected type: %v", pkg.Interfaces[0].Methods[0].ReturnType)
+	}
+}
+
+func TestParseArraysAndSets(t *testing.T) {
+	idl := "package foo\n\ntype Point struct {\n Coords [3]float\n Tags map[string]struct{}\n Grid [][0x2]int\n}"
+	pkg, err := Parse("arrays.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	float := PolyType{GoType: "float"}
+	str := PolyType{GoType: "string"}
+	intType := PolyType{GoType: "int"}
+	coords := PolyType{GoType: "float", IsList: true, Length: 3, Elem: &float}
+	tags := PolyType{GoType: "string", IsList: true, IsSet: true, Elem: &str}
+	grid := PolyType{GoType: "int", IsList: true,
+		Elem: &PolyType{GoType: "int", IsList: true, Length: 2, Elem: &intType}}
+
+	props := pkg.Structs[0].Props
+	for i, expected := range []PolyType{coords, tags, grid} {
+		if !reflect.DeepEqual(props[i].Type, expected) {
+			t.Errorf("Unexpected type for %s: %v", props[i].Name, props[i].Type)
+		}
+	}
+
+	_, err = Parse("arrays.go", "package foo\n\nconst n = 3\n\ntype Point struct {\n Coords [n]float\n}")
+	if err == nil || err.Error() != "arrays.go:6: Array length must be a positive integer (not n)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	_, err = Parse("arrays.go", "package foo\n\ntype Point struct {\n Seen map[time]struct{}\n}")
+	if err == nil || err.Error() != "arrays.go:4: Set elements must be int, float, bool, string, an enum or a named scalar (not time)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseBinary(t *testing.T) {
+	idl := "package foo\n\ntype Image struct {\n Data []byte\n Thumbs [][]byte\n}"
+	pkg, err := Parse("binary.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes := PolyType{GoType: "[]byte"}
+	if pkg.Structs[0].Props[0].Type != bytes {
+		t.Errorf("Unexpected type: %v", pkg.Structs[0].Props[0].Type)
+	}
+	thumbs := PolyType{GoType: "[]byte", IsList: true, Elem: &bytes}
+	if !reflect.DeepEqual(pkg.Structs[0].Props[1].Type, thumbs) {
+		t.Errorf("Unexpected type: %v", pkg.Structs[0].Props[1].Type)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	idl := "package foo\n\nimport \"time\"\n\ntype Event struct {\n At time.Time\n Log []time\n}"
+	pkg, err := Parse("time.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeType := PolyType{GoType: "time"}
+	if pkg.Structs[0].Props[0].Type != timeType {
+		t.Errorf("Unexpected type: %v", pkg.Structs[0].Props[0].Type)
+	}
+	if !pkg.UsesType("time") || pkg.UsesType("[]byte") {
+		t.Errorf("UsesType is wrong")
+	}
+
+	idl = "package foo\n\nimport t \"time\"\n\ntype Event struct {\n At t.Time\n}"
+	pkg, err = Parse("time.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Structs[0].Props[0].Type != timeType {
+		t.Errorf("Unexpected type: %v", pkg.Structs[0].Props[0].Type)
+	}
+}
+
+func TestParseWidths(t *testing.T) {
+	idl := "//polygen:int64 string\npackage foo\n\ntype Sample struct {\n Small int32\n Big int64\n Ratio float32\n Total float64\n}"
+	pkg, err := Parse("widths.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, gotype := range []string{"int32", "int64", "float32", "float64"} {
+		if pkg.Structs[0].Props[i].Type != (PolyType{GoType: gotype}) {
+			t.Errorf("Unexpected type: %v", pkg.Structs[0].Props[i].Type)
+		}
+	}
+	if pkg.Int64Encoding != Int64String || !pkg.Int64AsString() {
+		t.Errorf("Unexpected int64 encoding: %q", pkg.Int64Encoding)
+	}
+
+	_, err = Parse("widths.go", "//polygen:int64 text\npackage foo")
+	if err == nil || err.Error() != "widths.go:1: 'int64' must be number or string (not text)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	_, err = Parse("widths.go", "package foo\n\ntype Sample struct {\n Small int32 `default:3000000000`\n}")
+	if err == nil || !strings.Contains(err.Error(), "'default' must be an int32") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	idl := "package foo\n\ntype Price decimal\n\ntype Item struct {\n Price Price\n Rates []decimal\n}"
+	pkg, err := Parse("decimal.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Scalars[0].Type != (PolyType{GoType: "decimal"}) {
+		t.Errorf("Unexpected scalar type: %v", pkg.Scalars[0].Type)
+	}
+	decimal := PolyType{GoType: "decimal"}
+	rates := PolyType{GoType: "decimal", IsList: true, Elem: &decimal}
+	if !reflect.DeepEqual(pkg.Structs[0].Props[1].Type, rates) {
+		t.Errorf("Unexpected type: %v", pkg.Structs[0].Props[1].Type)
+	}
+	if !pkg.UsesType("decimal") {
+		t.Errorf("UsesType is wrong")
+	}
+
+	_, err = Parse("decimal.go", "package foo\n\ntype Item struct {\n Price decimal `default:1.50`\n}")
+	if err == nil || err.Error() != "decimal.go:4: 'default' may only be used on int, float, bool, string and enum fields" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	idl := `package foo
+
+// Person is a person
+//polygen:deprecated use Human
+type Person struct {
+	//polygen:deprecated
+	Name string
+}
+
+//polygen:deprecated
+type Status string
+
+const Active Status = "active"
+
+//polygen:deprecated use string
+type UserId string
+
+//polygen:role admin
+type Svc interface {
+	// Get a person
+	//polygen:idempotent
+	//polygen:timeout 5s
+	Get(id string) Person
+
+	//polygen:notification
+	Ping()
+}`
+	pkg, err := Parse("annotations.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := pkg.Structs[0]
+	if s.Comment != "Person is a person" {
+		t.Errorf("Directives should not be in comment: %q", s.Comment)
+	}
+	if !reflect.DeepEqual(s.Annotations, Annotations{"deprecated": "use Human"}) {
+		t.Errorf("Unexpected struct annotations: %v", s.Annotations)
+	}
+	if !s.Props[0].Annotations.Has("deprecated") {
+		t.Errorf("Unexpected field annotations: %v", s.Props[0].Annotations)
+	}
+	iface := pkg.Interfaces[0]
+	if iface.Annotations["role"] != "admin" {
+		t.Errorf("Unexpected interface annotations: %v", iface.Annotations)
+	}
+	expected := Annotations{"idempotent": "", "timeout": "5s"}
+	if !reflect.DeepEqual(iface.Methods[0].Annotations, expected) {
+		t.Errorf("Unexpected method annotations: %v", iface.Methods[0].Annotations)
+	}
+	if !iface.Methods[1].Annotations.Has("notification") {
+		t.Errorf("Unexpected method annotations: %v", iface.Methods[1].Annotations)
+	}
+	if !pkg.Enums[0].Annotations.Has("deprecated") {
+		t.Errorf("Unexpected enum annotations: %v", pkg.Enums[0].Annotations)
+	}
+	if pkg.Scalars[0].Annotations["deprecated"] != "use string" {
+		t.Errorf("Unexpected scalar annotations: %v", pkg.Scalars[0].Annotations)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	idl := `package foo
+
+//polygen:error 404
+type NotFound struct {
+	Id int
+}
+
+//polygen:error 403
+type Forbidden struct {
+	Reason string
+}
+
+type Svc interface {
+	Get(id int) (string, NotFound)
+
+	//polygen:throws NotFound, Forbidden
+	Delete(id int)
+}`
+	pkg, err := Parse("errors.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, ok := pkg.Structs[0].ErrorCode(); !ok || code != 404 {
+		t.Errorf("Unexpected error code: %d %v", code, ok)
+	}
+	m := pkg.Interfaces[0].Methods
+	if m[0].ReturnType.GoType != "string" {
+		t.Errorf("Unexpected return type: %v", m[0].ReturnType)
+	}
+	expected := []PolyType{{GoType: "NotFound"}}
+	if !reflect.DeepEqual(m[0].Throws, expected) {
+		t.Errorf("Unexpected errors for Get: %v", m[0].Throws)
+	}
+	expected = []PolyType{{GoType: "NotFound"}, {GoType: "Forbidden"}}
+	if !reflect.DeepEqual(m[1].Throws, expected) {
+		t.Errorf("Unexpected errors for Delete: %v", m[1].Throws)
+	}
+}
+
+func TestParseConstants(t *testing.T) {
+	idl := `package foo
+
+// MaxPageSize is the largest page size
+const MaxPageSize = 100
+
+const (
+	Version       = "1.0"
+	Ratio   float = 2
+	Debug         = true
+	Mask          = -0x10
+)`
+	pkg, err := Parse("constants.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearPositions(pkg)
+	expected := []Constant{
+		{Name: "MaxPageSize", Type: PolyType{GoType: "int"}, Value: "100", Comment: "MaxPageSize is the largest page size"},
+		{Name: "Version", Type: PolyType{GoType: "string"}, Value: "1.0"},
+		{Name: "Ratio", Type: PolyType{GoType: "float"}, Value: "2"},
+		{Name: "Debug", Type: PolyType{GoType: "bool"}, Value: "true"},
+		{Name: "Mask", Type: PolyType{GoType: "int"}, Value: "-16"},
+	}
+	if !reflect.DeepEqual(pkg.Constants, expected) {
+		t.Errorf("Unexpected constants:\n%v", pkg.Constants)
+	}
+}
+
+func TestParseUnion(t *testing.T) {
+	idl := `package foo
+
+type Card struct {
+	Number string
+}
+
+type Bank struct {
+	Iban string
+}
+
+//polygen:union kind
+type Payment struct {
+	Card Card
+	Bank Bank
+}
+
+//polygen:union
+type Other struct {
+	A Other2
+}
+
+type Other2 struct {
+	Kind string
+}`
+	pkg, err := Parse("union.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := pkg.FindStruct("Payment")
+	if !payment.IsUnion() || payment.Discriminator() != "kind" {
+		t.Errorf("Unexpected union: %v", payment)
+	}
+	if other := pkg.FindStruct("Other"); other.Discriminator() != "type" {
+		t.Errorf("Unexpected default discriminator: %s", other.Discriminator())
+	}
+	u, variant := pkg.UnionOf(pkg.FindStruct("Bank"))
+	if u != payment || VariantName(*variant) != "bank" {
+		t.Errorf("Unexpected union for Bank: %v %v", u, variant)
+	}
+	if u, _ := pkg.UnionOf(payment); u != nil {
+		t.Errorf("Payment is not a variant: %v", u)
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	files := []File{
+		File{"a.go", []byte("package foo\n\ntype Svc interface {\n Get(id int) Person\n Status() Status\n}")},
+		File{"b.go", []byte("package foo\n\nconst On Status = \"on\"\n\ntype Person struct {\n Name string\n}")},
+		File{"c.go", []byte("package foo\n\ntype Status string")},
+	}
+	pkg, err := ParseSources(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Name != "foo" || len(pkg.Structs) != 1 || len(pkg.Interfaces) != 1 {
+		t.Errorf("Unexpected package: %v", pkg)
+	}
+	if pkg.Structs[0].Pos.Filename != "b.go" || pkg.Structs[0].Pos.Line != 5 {
+		t.Errorf("Unexpected struct position: %v", pkg.Structs[0].Pos)
+	}
+	e := pkg.FindEnum("Status")
+	if e == nil || len(e.Values) != 1 || e.Pos.Filename != "c.go" {
+		t.Errorf("Unexpected enum: %v", e)
+	}
+}
+
+func writeIdlDir(t *testing.T, dir string, files map[string]string) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, code := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(code), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseImports(t *testing.T) {
+	root, err := ioutil.TempDir("", "polygen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeIdlDir(t, filepath.Join(root, "common"), map[string]string{
+		"common.go": "package common\n\ntype Color string\nconst Red Color = \"red\"\n\ntype Address struct {\n Street string\n}",
+	})
+	writeIdlDir(t, filepath.Join(root, "app"), map[string]string{
+		"app.go":  "package app\n\nimport \"../common\"\n\ntype Person struct {\n Home common.Address\n Fav *common.Color\n}",
+		"svc.go":  "package app\n\nimport c \"../common\"\n\ntype Svc interface {\n Move(to c.Address) []c.Color\n}",
+		"bad.txt": "not idl",
+	})
+
+	pkg, err := ParseDir(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.Imports) != 1 || pkg.Imports[0].Pkg.Name != "common" {
+		t.Fatalf("Unexpected imports: %v", pkg.Imports)
+	}
+	home := pkg.Structs[0].Props[0].Type
+	if home != (PolyType{GoType: "Address", Package: "common"}) {
+		t.Errorf("Unexpected type: %v", home)
+	}
+	if pkg.ResolveStruct(home) == nil {
+		t.Errorf("Could not resolve %s", home.QualifiedName())
+	}
+	ret := pkg.Interfaces[0].Methods[0].ReturnType
+	if ret.QualifiedName() != "common.Color" || !ret.IsList || pkg.ResolveEnum(ret) == nil {
+		t.Errorf("Unexpected return type: %v", ret)
+	}
+
+	writeIdlDir(t, filepath.Join(root, "bad"), map[string]string{
+		"bad.go": "package bad\n\nimport \"../common\"\n\ntype Person struct {\n Home common.House\n Work other.Address\n}",
+	})
+	_, err = ParseDir(filepath.Join(root, "bad"))
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	msgs := strings.Split(err.Error(), "\n")
+	if len(msgs) != 2 || !strings.HasSuffix(msgs[0], "bad.go:6: Unknown type common.House") ||
+		!strings.HasSuffix(msgs[1], "bad.go:7: Unknown package: other") {
+		t.Errorf("Unexpected errors: %s", err.Error())
+	}
+}
+
+func TestParseWireNames(t *testing.T) {
+	idl := "//polygen:wire snake_case\npackage foo\n\ntype Person struct {\n UserId int\n" +
+		" HomeURL string `json:\"home,omitempty\" maxLength:100`\n}"
+	pkg, err := Parse("test.go", idl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := pkg.Structs[0].Props
+	if pkg.WireCase != SnakeCase || WireName(props[0]) != "user_id" || WireName(props[1]) != "home" ||
+		*props[1].Constraints.MaxLength != 100 {
+		t.Errorf("Unexpected wire names: %v", pkg)
+	}
+
+	_, err = Parse("test.go", "//polygen:wire kebab\npackage foo")
+	if err == nil || err.Error() != "test.go:1: 'wire' must be camelCase or snake_case (not kebab)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	_, err = Parse("test.go", "package foo\n\ntype Person struct {\n Id int\n Key int `json:id`\n}")
+	if err == nil || err.Error() != "test.go:5: Fields Id and Key of struct Person have the same wire name id" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestWireCaseName(t *testing.T) {
+	cases := map[string][]string{
+		"Id":        {"id", "id"},
+		"userId":    {"userId", "user_id"},
+		"URLPath":   {"urlPath", "url_path"},
+		"HTTP":      {"http", "http"},
+		"Say_Hi":    {"say_Hi", "say_hi"},
+		"Page2Size": {"page2Size", "page2_size"},
+	}
+	for name, expected := range cases {
+		camel, snake := wireCaseName(name, CamelCase), wireCaseName(name, SnakeCase)
+		if camel != expected[0] || snake != expected[1] {
+			t.Errorf("%s: got %s and %s, expected %v", name, camel, snake, expected)
+		}
+	}
+}
+
 // Validation tests
 //
 // Verify filename in output is correct
@@ -99,6 +832,28 @@ func TestErrFilename(t *testing.T) {
 	}
 }
 
+func TestParseSourcesErrFilename(t *testing.T) {
+	files := []File{
+		File{"a.go", []byte("package foo\n\ntype Svc interface {\n Get(id int) int\n}")},
+		File{"b.go", []byte("package foo\n\n\ntype Empty interface {\n}")},
+		File{"c.go", []byte("package bar\n")},
+	}
+	_, err := ParseSources(files)
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	msgs := strings.Split(err.Error(), "\n")
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 errors, got: %s", err.Error())
+	}
+	if !strings.HasPrefix(msgs[0], "c.go:1: ") {
+		t.Errorf("err didn't start with c.go:1: - %s", msgs[0])
+	}
+	if !strings.HasPrefix(msgs[1], "b.go:4: ") {
+		t.Errorf("err didn't start with b.go:4: - %s", msgs[1])
+	}
+}
+
 // Verify line number in error output is correct
 func TestErrLineNum(t *testing.T) {
 	idl := "package foo\nimport (\"fmt\")"
@@ -111,19 +866,147 @@ func TestErrLineNum(t *testing.T) {
 	}
 }
 
+func TestUnknownType(t *testing.T) {
+	idl := `package foo
+
+type Person struct {
+	Name strng
+}
+
+type Svc interface {
+	Create(p Persn) Result
+	Nope() Svc
+}`
+	_, err := Parse("example1.go", idl)
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	expected := []string{
+		"example1.go:4: Unknown type: strng (did you mean string?)",
+		"example1.go:8: Unknown type: Persn (did you mean Person?)",
+		"example1.go:8: Unknown type: Result",
+		"example1.go:9: Interface Svc may not be used as a type",
+	}
+	msgs := strings.Split(err.Error(), "\n")
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("Unexpected errors:\n%s", err.Error())
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	idl := "package foo\n\ntype Person struct {\n userId int\n UserID int\n}\n\ntype person struct {\n A int\n}\n\n" +
+		"type Svc interface {\n Get(a int, A int) Person\n get() int\n}"
+	_, err := Parse("test.go", idl)
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	expected := []string{
+		"test.go:5: Field Person.UserID differs only in case from field Person.userId at test.go:4",
+		"test.go:8: Struct person differs only in case from struct Person at test.go:3",
+		"test.go:13: Argument A of Svc.Get differs only in case from argument a of Svc.Get at test.go:13",
+		"test.go:14: Method Svc.get differs only in case from method Svc.Get at test.go:13",
+	}
+	if msgs := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("Unexpected errors:\n%s", err.Error())
+	}
+	related := Diagnostics(err)[0].Related
+	if len(related) != 1 || related[0].Line != 4 || related[0].Message != "Field Person.userId is declared here" {
+		t.Errorf("Unexpected related errors: %+v", related)
+	}
+}
+
+func TestDuplicateTypeNames(t *testing.T) {
+	idl := "package foo\n\ntype Person struct {\n Name string\n}\n\ntype Person interface {\n Get() int\n}"
+	_, err := Parse("example1.go", idl)
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	if err.Error() != "example1.go:7: Interface Person is already declared at example1.go:3" {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
 var illegalIdl = []string{
 	"const huge = 1 << 100\ntype foo struct {\n foo huge\n}",
 	"func foo() int { return 1 }",
 	"var foo string\n",
 	"type foo interface { }",
-	"type foo struct {\n a int64\n}",
 	"type foo struct {\n a uint64\n}",
-	"type foo struct {\n a float64\n}",
+	"type foo struct {\n a int16\n}",
 	"type foo struct {\n a map[int] string\n}",
-	"type foo struct {\n a map[string] map[string] int\n}",
 	"type foo interface {\n doSomething() (int, int)\n}",
 	"type foo interface {\n doSomething(int, int) int\n}",
 	"type foo interface {\n doSomething(foo ...int) int\n}",
+	"const foo = bar",
+	"const foo int = 1.5",
+	"const foo bool = 1",
+	"const foo = -\"x\"",
+	"const foo = 99999999999999999999",
+	"const (\n a = iota\n b\n)",
+	"const foo = 1\ntype bar struct {\n a foo\n}",
+	"const foo = 1\ntype foo struct {\n a int\n}",
+	"type bar string\nconst x bar = \"x\"\ntype foo struct {\n a bar \"default:y\"\n}",
+	"type bar struct {\n a int\n}\ntype foo struct {\n a bar \"default:y\"\n}",
+	"//polygen:union\ntype foo struct {\n a int\n}",
+	"//polygen:union\ntype foo struct {\n}",
+	"//polygen:union kind-of\ntype foo struct {\n a bar\n}\ntype bar struct {\n b int\n}",
+	"//polygen:union\ntype foo struct {\n a bar\n b bar\n}\ntype bar struct {\n b int\n}",
+	"//polygen:union\ntype foo struct {\n a *bar\n}\ntype bar struct {\n b int\n}",
+	"//polygen:union\ntype foo struct {\n a bar\n}\ntype bar struct {\n Type int\n}",
+	"//polygen:union\ntype foo struct {\n a bar \"required\"\n}\ntype bar struct {\n b int\n}",
+	"//polygen:union\ntype foo struct {\n a bar\n}\n//polygen:union\ntype bar struct {\n a foo\n}",
+	"type foo string\nconst a foo = 1",
+	"type foo string\nconst (\n a foo = \"x\"\n b\n)",
+	"type foo string\nconst (\n a foo = \"x\"\n b foo = \"x\"\n)",
+	"const a bar = \"x\"",
+	"type foo struct {\n a **int\n}",
+	"type foo struct {\n a []*int\n}",
+	"type foo struct {\n a map[string]*int\n}",
+	"type foo struct {\n a map[string][]*int\n}",
+	"type foo struct {\n a [][]bar\n}",
+	"type foo struct {\n a byte\n}",
+	"type foo struct {\n a []uint8\n}",
+	"type foo struct {\n a time.Time\n}",
+	"import \"time\"\ntype foo struct {\n a time.Duration\n}",
+	"//polygen:colour red\ntype foo struct {\n a int\n}",
+	"//polygen:idempotent\ntype foo struct {\n a int\n}",
+	"type foo interface {\n //polygen:role\n a()\n}",
+	"type foo interface {\n //polygen:idempotent yes\n a()\n}",
+	"type foo interface {\n //polygen:timeout soon\n a()\n}",
+	"type foo interface {\n //polygen:deprecated\n //polygen:deprecated\n a()\n}",
+	"type foo interface {\n //polygen:notification\n a() int\n}",
+	"//polygen:role admin\ntype foo string\nconst a foo = \"a\"",
+	"type foo struct {\n a *uint32\n}",
+	"type foo struct {\n a int32 `default:3000000000`\n}",
+	"type foo struct {\n a int \"pattern: x\"\n}",
+	"type foo struct {\n a string \"colour: red\"\n}",
+	"type foo struct {\n a common.Address\n}",
+	"import \"../missing\"",
+	"type foo struct {\n string\n}",
+	"type bar struct {\n a int\n}\ntype foo struct {\n *bar\n}",
+	"type bar struct {\n a int\n}\ntype foo struct {\n bar \"required\"\n}",
+	"type bar struct {\n foo\n}\ntype foo struct {\n bar\n}",
+	"type bar struct {\n a int\n}\ntype foo struct {\n bar\n a string\n}",
+	"type foo struct {\n a bar\n}",
+	"type foo struct {\n a int\n}\ntype foo string\nconst x foo = \"x\"",
+	"//polygen:error -32600\ntype foo struct {\n a int\n}",
+	"//polygen:error oops\ntype foo struct {\n a int\n}",
+	"//polygen:error 1\ntype foo struct {\n a int\n}\n//polygen:error 1\ntype bar struct {\n a int\n}",
+	"type bar struct {\n a int\n}\ntype foo interface {\n a() (int, bar)\n}",
+	"type foo interface {\n //polygen:throws bar\n a()\n}",
+	"//polygen:error 1\ntype bar struct {\n a int\n}\ntype foo interface {\n a() (int, bar, bar)\n}",
+	"//polygen:error 1\ntype bar struct {\n a int\n}\ntype foo interface {\n //polygen:throws bar\n a() (int, bar)\n}",
+	"type foo struct {\n A int\n b int `json:a`\n}",
+	"type foo struct {\n A int `json:\"-\"`\n}",
+	"type foo struct {\n A int `json:\",omitempty\"`\n}",
+	"type bar struct {\n a int\n}\ntype foo struct {\n bar\n B int `json:a`\n}",
+	"//polygen:wire snake_case\ntype foo struct {\n a int\n}",
+	"type foo struct {\n a [0]int\n}",
+	"type foo struct {\n a [...]int\n}",
+	"type foo struct {\n a [4]byte\n}",
+	"type foo struct {\n a map[string]struct{ b int }\n}",
+	"type bar struct {\n a int\n}\ntype foo struct {\n a map[bar]struct{}\n}",
+	"type foo interface {\n a(b []map[[]byte]struct{})\n}",
 }
 
 func TestIllegalIdl(t *testing.T) {
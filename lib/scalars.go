@@ -0,0 +1,78 @@
+package polygenlib
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// Scalar is a named integer, float, decimal, bool or string type, declared
+// in the IDL to document what a value holds, e.g.
+//
+//	// UserId identifies a user account
+//	type UserId string
+//
+// A named string type becomes an Enum instead if any constants are
+// declared with it. Scalars are sent on the wire as their builtin type.
+type Scalar struct {
+	Name string
+	// Type is one of the integer, float, decimal, bool or string builtins
+	Type        PolyType
+	Comment     string
+	Pos         token.Position
+	Annotations Annotations
+}
+
+// FindScalar returns the named scalar with the given name, or nil if the
+// package has no such scalar
+func (p *Package) FindScalar(name string) *Scalar {
+	for i := 0; i < len(p.Scalars); i++ {
+		if p.Scalars[i].Name == name {
+			return &p.Scalars[i]
+		}
+	}
+	return nil
+}
+
+// ResolveScalar returns the named scalar that t refers to, or nil if t
+// does not refer to a named scalar
+func (p *Package) ResolveScalar(t PolyType) *Scalar {
+	return p.TypePackage(t).FindScalar(t.GoType)
+}
+
+// visitNamedType records the type declared by spec as a named scalar.
+// Named string types are also recorded as enums, as their values may be
+// declared later. Each is removed from one list or the other by
+// setScalars.
+func (v *Visitor) visitNamedType(spec *ast.TypeSpec, ident *ast.Ident) {
+	a := v.parseAnnotations(v.lastDoc, onEnum)
+	if !constantTypes[ident.Name] && !isInteger(ident.Name) && !isFloat(ident.Name) && ident.Name != "decimal" {
+		msg := "Named types must be an integer, float, decimal, bool or string type (not " + ident.Name + ")"
+		v.AddErr(v.nodeErr(ident, CodeUnsupportedType, msg))
+		return
+	}
+	sc := Scalar{spec.Name.Name, PolyType{GoType: ident.Name}, commentText(v.lastDoc), v.lastPos, a}
+	v.pkg.Scalars = append(v.pkg.Scalars, sc)
+	if ident.Name == "string" {
+		e := Enum{spec.Name.Name, []EnumValue{}, commentText(v.lastDoc), v.lastPos, a}
+		v.pkg.Enums = append(v.pkg.Enums, e)
+	}
+}
+
+// setScalars removes the named string types that have values from the
+// package's scalars, and those that have none from its enums
+func (v *Visitor) setScalars() {
+	enums := make([]Enum, 0, len(v.pkg.Enums))
+	for _, e := range v.pkg.Enums {
+		if len(e.Values) > 0 {
+			enums = append(enums, e)
+		}
+	}
+	v.pkg.Enums = enums
+	scalars := make([]Scalar, 0, len(v.pkg.Scalars))
+	for _, sc := range v.pkg.Scalars {
+		if v.pkg.FindEnum(sc.Name) == nil {
+			scalars = append(scalars, sc)
+		}
+	}
+	v.pkg.Scalars = scalars
+}
@@ -0,0 +1,284 @@
+package polygenlib
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Constraints are the validation rules declared in a struct field's tag.
+// Generated dispatchers check them before the service method is called.
+//
+// A tag is a space separated list of entries. Each entry is a key,
+// optionally followed by a colon and a value. Values may be Go quoted
+// strings, or run to the next whitespace. For example:
+//
+//	Email string "required pattern: \\S+@\\S+.\\S+ maxLength: 255"
+//	Age   int    `min:0 max:150`
+//	Role  string `default:guest`
+//
+// The tag may also give the field's wire name with a json entry.
+type Constraints struct {
+	Pattern   string
+	Min       *float64
+	Max       *float64
+	MinLength *int
+	MaxLength *int
+	Required  bool
+	// Default is the value a missing field is given, in the canonical form
+	// of a Constant value. nil if the tag declares no default.
+	Default *string
+}
+
+// TagEntry is a single key/value pair parsed from a field tag
+type TagEntry struct {
+	Key   string
+	Value string
+	// HasValue is false for entries given as a bare key, such as "required"
+	HasValue bool
+}
+
+// ParseTag splits a field tag into its entries
+func ParseTag(tag string) ([]TagEntry, error) {
+	entries := make([]TagEntry, 0)
+	rest := strings.TrimSpace(tag)
+	for rest != "" {
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			return r == ':' || unicode.IsSpace(r)
+		})
+		if end < 0 {
+			end = len(rest)
+		}
+		entry := TagEntry{Key: rest[0:end]}
+		if entry.Key == "" {
+			return nil, fmt.Errorf("Invalid tag: %s", tag)
+		}
+		rest = rest[end:]
+		if strings.HasPrefix(rest, ":") {
+			rest = strings.TrimLeftFunc(rest[1:], unicode.IsSpace)
+			val, remain, err := tagValue(rest)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value for tag key '%s': %s", entry.Key, err)
+			}
+			entry.Value = val
+			entry.HasValue = true
+			rest = remain
+		}
+		entries = append(entries, entry)
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+	return entries, nil
+}
+
+// tagValue reads a single value from the start of s, returning the value
+// and the remainder of s
+func tagValue(s string) (string, string, error) {
+	if strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "`") {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", err
+		}
+		val, err := strconv.Unquote(quoted)
+		return val, s[len(quoted):], err
+	}
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("missing value")
+	}
+	return s[0:end], s[end:], nil
+}
+
+// ParseConstraints parses a field tag into the constraints it declares
+// for a field of type t
+func ParseConstraints(tag string, t PolyType) (Constraints, error) {
+	c := Constraints{}
+	entries, err := ParseTag(tag)
+	if err != nil {
+		return c, err
+	}
+
+	isNum := !t.IsList && !t.IsMap && (isInteger(t.GoType) || isFloat(t.GoType))
+	isString := !t.IsList && !t.IsMap && t.GoType == "string"
+	hasLen := isString || t.IsList || t.IsMap
+
+	for _, e := range entries {
+		if !e.HasValue && e.Key != "required" {
+			return c, fmt.Errorf("Tag key '%s' requires a value", e.Key)
+		}
+		switch e.Key {
+		case "pattern":
+			if !isString {
+				return c, fmt.Errorf("'pattern' may only be used on string fields")
+			}
+			// the pattern is copied into generated code, which would fail
+			// when it is loaded
+			if _, err := regexp.Compile(e.Value); err != nil {
+				return c, fmt.Errorf("'pattern' is not a valid regular expression: %s", err)
+			}
+			c.Pattern = e.Value
+		case "min", "max":
+			if !isNum {
+				return c, fmt.Errorf("'%s' may only be used on int and float fields", e.Key)
+			}
+			f, err := strconv.ParseFloat(e.Value, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return c, fmt.Errorf("'%s' must be a finite number (not %s)", e.Key, e.Value)
+			}
+			if e.Key == "min" {
+				c.Min = &f
+			} else {
+				c.Max = &f
+			}
+		case "minLength", "maxLength":
+			if !hasLen {
+				return c, fmt.Errorf("'%s' may only be used on string, list and map fields", e.Key)
+			}
+			i, err := strconv.Atoi(e.Value)
+			if err != nil || i < 0 {
+				return c, fmt.Errorf("'%s' must be a non-negative integer (not %s)", e.Key, e.Value)
+			}
+			if e.Key == "minLength" {
+				c.MinLength = &i
+			} else {
+				c.MaxLength = &i
+			}
+		case "default":
+			val, err := defaultValue(e.Value, t)
+			if err != nil {
+				return c, err
+			}
+			c.Default = &val
+		case "required":
+			if e.HasValue {
+				b, err := strconv.ParseBool(e.Value)
+				if err != nil {
+					return c, fmt.Errorf("'required' must be true or false (not %s)", e.Value)
+				}
+				c.Required = b
+			} else {
+				c.Required = true
+			}
+			if c.Required && t.IsOptional {
+				return c, fmt.Errorf("Optional fields may not be required")
+			}
+		case "json":
+			// the wire name of the field, read by jsonTagName
+		default:
+			return c, fmt.Errorf("Unknown tag key: %s", e.Key)
+		}
+	}
+
+	if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+		return c, fmt.Errorf("'min' is greater than 'max'")
+	}
+	if c.MinLength != nil && c.MaxLength != nil && *c.MinLength > *c.MaxLength {
+		return c, fmt.Errorf("'minLength' is greater than 'maxLength'")
+	}
+	if c.Default != nil {
+		if c.Required {
+			return c, fmt.Errorf("Required fields may not have a default")
+		}
+		if err := checkDefault(c, t); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// defaultValue returns the canonical form of the default val for a field
+// of type t. Defaults for named types are checked to be enum values when
+// the package's types are resolved.
+func defaultValue(val string, t PolyType) (string, error) {
+	if t.IsList || t.IsMap || t.GoType == "[]byte" || t.GoType == "time" || t.GoType == "decimal" {
+		return "", fmt.Errorf("'default' may only be used on int, float, bool, string and enum fields")
+	}
+	switch {
+	case isInteger(t.GoType):
+		i, err := strconv.ParseInt(val, 10, bitSize(t.GoType))
+		if err != nil {
+			return "", fmt.Errorf("'default' must be an %s (not %s)", t.GoType, val)
+		}
+		return strconv.FormatInt(i, 10), nil
+	case isFloat(t.GoType):
+		f, err := strconv.ParseFloat(val, bitSize(t.GoType))
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("'default' must be a finite number (not %s)", val)
+		}
+		return formatFloat(f), nil
+	case t.GoType == "bool":
+		if val != "true" && val != "false" {
+			return "", fmt.Errorf("'default' must be true or false (not %s)", val)
+		}
+	}
+	return val, nil
+}
+
+// checkDefault checks the default declared in c satisfies the other
+// constraints in c
+func checkDefault(c Constraints, t PolyType) error {
+	val := *c.Default
+	if isInteger(t.GoType) || isFloat(t.GoType) {
+		f, _ := strconv.ParseFloat(val, 64)
+		if (c.Min != nil && f < *c.Min) || (c.Max != nil && f > *c.Max) {
+			return fmt.Errorf("'default' %s is outside 'min' and 'max'", val)
+		}
+	} else if t.GoType == "string" {
+		n := utf8.RuneCountInString(val)
+		if (c.MinLength != nil && n < *c.MinLength) || (c.MaxLength != nil && n > *c.MaxLength) {
+			return fmt.Errorf("'default' %q is outside 'minLength' and 'maxLength'", val)
+		}
+		if c.Pattern != "" && !regexp.MustCompile(c.Pattern).MatchString(val) {
+			return fmt.Errorf("'default' %q does not match 'pattern'", val)
+		}
+	}
+	return nil
+}
+
+// checkDefault adds an error if prop has a default but is not of a
+// builtin type, unless its type is an enum and the default is one of the
+// enum's values
+func (v *Visitor) checkDefault(s *Struct, prop Property) {
+	if prop.Constraints.Default == nil || IsBuiltin(prop.Type.GoType) {
+		return
+	}
+	val := *prop.Constraints.Default
+	e := v.pkg.ResolveEnum(prop.Type)
+	if e == nil {
+		if v.pkg.ResolveStruct(prop.Type) != nil || v.pkg.ResolveScalar(prop.Type) != nil {
+			msg := fmt.Sprintf("Field %s.%s: 'default' may only be used on int, float, bool, string and enum fields",
+				s.Name, prop.Name)
+			v.AddErr(posErr(prop.Pos, CodeInvalidDefault, msg))
+		}
+		return
+	}
+	vals := make([]string, 0)
+	for _, ev := range e.Values {
+		if ev.Value == val {
+			return
+		}
+		vals = append(vals, ev.Value)
+	}
+	msg := fmt.Sprintf("Field %s.%s: 'default' must be one of: %s (not %s)",
+		s.Name, prop.Name, strings.Join(vals, ", "), val)
+	v.AddErr(posErr(prop.Pos, CodeInvalidDefault, msg))
+}
+
+// defaultDoc returns the doc comment of prop, followed by a sentence
+// giving its default if it has one
+func defaultDoc(prop Property) string {
+	if prop.Constraints.Default == nil {
+		return prop.Comment
+	}
+	val := *prop.Constraints.Default
+	if !isInteger(prop.Type.GoType) && !isFloat(prop.Type.GoType) && prop.Type.GoType != "bool" {
+		val = quoteString(val)
+	}
+	return strings.TrimSpace(prop.Comment + "\n\nDefaults to " + val + ".")
+}
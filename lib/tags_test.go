@@ -0,0 +1,103 @@
+package polygenlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	tag := "required pattern: \\S+@\\S+ min:1 label:\"two words\" x: `raw`"
+	entries, err := ParseTag(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TagEntry{
+		TagEntry{"required", "", false},
+		TagEntry{"pattern", "\\S+@\\S+", true},
+		TagEntry{"min", "1", true},
+		TagEntry{"label", "two words", true},
+		TagEntry{"x", "raw", true},
+	}
+	if !reflect.DeepEqual(expected, entries) {
+		t.Errorf("%v != %v", expected, entries)
+	}
+}
+
+func TestParseConstraints(t *testing.T) {
+	c, err := ParseConstraints("min: 0 max:150.5", PolyType{GoType: "float"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Min == nil || *c.Min != 0 || c.Max == nil || *c.Max != 150.5 {
+		t.Errorf("Unexpected min/max: %v", c)
+	}
+
+	c, err = ParseConstraints("required minLength:1 maxLength:5", PolyType{GoType: "int", IsList: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Required || *c.MinLength != 1 || *c.MaxLength != 5 {
+		t.Errorf("Unexpected constraints: %v", c)
+	}
+}
+
+func TestParseDefault(t *testing.T) {
+	defaults := []struct {
+		tag      string
+		ptype    PolyType
+		expected string
+	}{
+		{"default:020", PolyType{GoType: "int"}, "20"},
+		{"default: 1.50", PolyType{GoType: "float"}, "1.5"},
+		{"default:false", PolyType{GoType: "bool"}, "false"},
+		{"default:\"two words\" maxLength:9", PolyType{GoType: "string"}, "two words"},
+		{"default:active", PolyType{GoType: "Status"}, "active"},
+	}
+	for _, x := range defaults {
+		c, err := ParseConstraints(x.tag, x.ptype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Default == nil || *c.Default != x.expected {
+			t.Errorf("Unexpected default for %s: %v", x.tag, c.Default)
+		}
+	}
+}
+
+var illegalTags = []struct {
+	tag   string
+	ptype PolyType
+}{
+	{"pattern: a+", PolyType{GoType: "int"}},
+	{"min: 1", PolyType{GoType: "string"}},
+	{"min: abc", PolyType{GoType: "int"}},
+	{"max", PolyType{GoType: "int"}},
+	{"min: 5 max: 1", PolyType{GoType: "int"}},
+	{"maxLength: -1", PolyType{GoType: "string"}},
+	{"maxLength: 2", PolyType{GoType: "bool"}},
+	{"required", PolyType{GoType: "string", IsOptional: true}},
+	{"required: maybe", PolyType{GoType: "string"}},
+	{"colour: red", PolyType{GoType: "string"}},
+	{"pattern: \"unterminated", PolyType{GoType: "string"}},
+	{"pattern: \"(ab\"", PolyType{GoType: "string"}},
+	{"min: -Inf", PolyType{GoType: "float"}},
+	{"max: NaN", PolyType{GoType: "float"}},
+	{"default: x", PolyType{GoType: "int"}},
+	{"default: \"NaN\"", PolyType{GoType: "float"}},
+	{"default: +Inf", PolyType{GoType: "float"}},
+	{"default: 1", PolyType{GoType: "bool"}},
+	{"default: a", PolyType{GoType: "string", IsList: true}},
+	{"default: a", PolyType{GoType: "time"}},
+	{"required default: a", PolyType{GoType: "string"}},
+	{"default: 5 max: 4", PolyType{GoType: "int"}},
+	{"default: abc pattern: ^x", PolyType{GoType: "string"}},
+}
+
+func TestIllegalTags(t *testing.T) {
+	for _, x := range illegalTags {
+		_, err := ParseConstraints(x.tag, x.ptype)
+		if err == nil {
+			t.Errorf("expected err for: %s", x.tag)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package polygenlib
+
+import (
+	"go/token"
+	"strings"
+)
+
+// CheckTypes resolves every type referenced by the package. Each type must
+// be a builtin, or a struct, enum or named scalar declared in the IDL. Types from
+// imported packages are resolved when they are parsed. Declared names must
+// also be unique, ignoring case, across structs, enums, interfaces and
+// constants, and among the methods of an interface and their arguments.
+func (v *Visitor) CheckTypes() {
+	v.checkTypeNames()
+	v.checkMethodNames()
+
+	for _, s := range v.pkg.Structs {
+		for _, prop := range s.Props {
+			v.checkType(prop.Type, prop.Pos)
+			v.checkDefault(&s, prop)
+		}
+	}
+	for _, iface := range v.pkg.Interfaces {
+		for _, m := range iface.Methods {
+			for _, arg := range m.Args {
+				v.checkType(arg.Type, arg.Pos)
+			}
+			if !m.ReturnType.IsVoid {
+				v.checkType(m.ReturnType, m.Pos)
+			}
+		}
+	}
+
+	v.checkErrors()
+	v.checkUnions()
+}
+
+// checkType adds an error if t does not refer to a builtin or to a
+// struct, enum or named scalar declared in the package
+func (v *Visitor) checkType(t PolyType, pos token.Position) {
+	v.checkSetElem(t, pos)
+	if t.Package != "" || IsBuiltin(t.GoType) || v.pkg.FindStruct(t.GoType) != nil ||
+		v.pkg.FindEnum(t.GoType) != nil || v.pkg.FindScalar(t.GoType) != nil {
+		return
+	}
+	for _, iface := range v.pkg.Interfaces {
+		if iface.Name == t.GoType {
+			v.AddErr(posErr(pos, CodeNotAType, "Interface "+t.GoType+" may not be used as a type"))
+			return
+		}
+	}
+	if v.pkg.FindConstant(t.GoType) != nil {
+		v.AddErr(posErr(pos, CodeNotAType, "Constant "+t.GoType+" may not be used as a type"))
+		return
+	}
+
+	msg := "Unknown type: " + t.GoType
+	if s := v.suggestType(t.GoType); s != "" {
+		msg += " (did you mean " + s + "?)"
+	}
+	v.AddErr(posErr(pos, CodeUnknownType, msg))
+}
+
+// checkSetElem adds an error if t is, or contains, a set of structs,
+// binary data or timestamps. Set elements are compared by value, so must
+// be numbers, bools, strings, enums or named scalars.
+func (v *Visitor) checkSetElem(t PolyType, pos token.Position) {
+	for t.Elem != nil && !t.IsSet {
+		t = *t.Elem
+	}
+	if !t.IsSet {
+		return
+	}
+	if t.GoType == "[]byte" || t.GoType == "time" || v.pkg.ResolveStruct(t) != nil {
+		msg := "Set elements must be int, float, bool, string, an enum or a named scalar (not " + t.Elem.QualifiedName() + ")"
+		v.AddErr(posErr(pos, CodeInvalidSetElem, msg))
+	}
+}
+
+// suggestType returns the builtin or declared type name closest to name,
+// or an empty string if none is close enough to be a likely typo
+func (v *Visitor) suggestType(name string) string {
+	candidates := []string{"int", "float", "decimal", "bool", "string"}
+	for _, s := range v.pkg.Structs {
+		candidates = append(candidates, s.Name)
+	}
+	for _, e := range v.pkg.Enums {
+		candidates = append(candidates, e.Name)
+	}
+	for _, sc := range v.pkg.Scalars {
+		candidates = append(candidates, sc.Name)
+	}
+
+	// allow roughly one edit per three characters, compared without case
+	maxDist := (len(name) + 2) / 3
+	if maxDist > 3 {
+		maxDist = 3
+	}
+	best := ""
+	for _, c := range candidates {
+		d := levenshtein(strings.ToLower(name), strings.ToLower(c))
+		if d <= maxDist {
+			best = c
+			maxDist = d - 1
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,128 @@
+package polygenlib
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// A union is a struct annotated with //polygen:union whose fields are its
+// variants, e.g.
+//
+//	//polygen:union kind
+//	type Payment struct {
+//		Card CardPayment
+//		Bank BankPayment
+//	}
+//
+// A Payment value is exactly one of the variant structs. On the wire it
+// is sent as the fields of that struct, plus a discriminator property
+// (kind above, "type" if no name is given) holding the wire name of the
+// variant field, e.g. {"kind": "card", "number": "..."}. Variant structs
+// are always sent with their discriminator, even where they are used on
+// their own.
+
+// defaultDiscriminator is the discriminator property of unions that do
+// not name one
+const defaultDiscriminator = "type"
+
+// IsUnion returns true if s is declared as a union of its fields' types
+func (s *Struct) IsUnion() bool {
+	return s.Annotations.Has("union")
+}
+
+// Discriminator returns the name of the property that identifies the
+// variant of the union s on the wire
+func (s *Struct) Discriminator() string {
+	if d := s.Annotations["union"]; d != "" {
+		return d
+	}
+	return defaultDiscriminator
+}
+
+// VariantName returns the discriminator value of the union variant
+// declared by the field prop, which is the field's wire name
+func VariantName(prop Property) string {
+	return WireName(prop)
+}
+
+// UnionOf returns the union that s is a variant of, and the field of the
+// union that declares it. Returns nil if s is not a variant.
+func (p *Package) UnionOf(s *Struct) (*Struct, *Property) {
+	for i := 0; i < len(p.Structs); i++ {
+		u := &p.Structs[i]
+		if !u.IsUnion() {
+			continue
+		}
+		for x := 0; x < len(u.Props); x++ {
+			if u.Props[x].Type.GoType == s.Name {
+				return u, &u.Props[x]
+			}
+		}
+	}
+	return nil, nil
+}
+
+var discriminatorPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkDiscriminator checks a union discriminator is a plain identifier
+func checkDiscriminator(val string) error {
+	if val != "" && !discriminatorPattern.MatchString(val) {
+		return fmt.Errorf("'union' discriminator must be an identifier (not %s)", val)
+	}
+	return nil
+}
+
+// checkUnions checks that the variants of each union are distinct structs
+// declared in the package, that no struct is a variant of more than one
+// union, and that no variant has a field with the discriminator's name
+func (v *Visitor) checkUnions() {
+	variantOf := make(map[string]string)
+	for i := 0; i < len(v.pkg.Structs); i++ {
+		u := &v.pkg.Structs[i]
+		if !u.IsUnion() {
+			continue
+		}
+		if len(u.Embeds) > 0 {
+			v.AddErr(posErr(u.Pos, CodeInvalidUnion, "Union "+u.Name+" may not embed other structs"))
+		}
+		if len(u.Props) == 0 {
+			v.AddErr(posErr(u.Pos, CodeInvalidUnion, "Union "+u.Name+" has no variants"))
+		}
+		if _, ok := u.ErrorCode(); ok {
+			v.AddErr(posErr(u.Pos, CodeInvalidUnion, "Union "+u.Name+" may not be an error type"))
+		}
+
+		for _, prop := range u.Props {
+			t := prop.Type
+			var s *Struct
+			if t.Package == "" && !t.IsList && !t.IsMap && !t.IsOptional {
+				s = v.pkg.FindStruct(t.GoType)
+			}
+			if s == nil || s.IsUnion() {
+				if v.pkg.ResolveStruct(t) != nil || v.pkg.ResolveEnum(t) != nil || IsBuiltin(t.GoType) {
+					msg := fmt.Sprintf("Variant %s of union %s must be a struct declared in this package, and not a union",
+						prop.Name, u.Name)
+					v.AddErr(posErr(prop.Pos, CodeInvalidUnion, msg))
+				}
+				continue
+			}
+			if prop.Constraints != (Constraints{}) {
+				msg := fmt.Sprintf("Variant %s of union %s may not have constraints", prop.Name, u.Name)
+				v.AddErr(posErr(prop.Pos, CodeInvalidUnion, msg))
+			}
+			if prev, ok := variantOf[s.Name]; ok {
+				msg := fmt.Sprintf("Struct %s is already a variant of union %s", s.Name, prev)
+				v.AddErr(posErr(prop.Pos, CodeInvalidUnion, msg))
+				continue
+			}
+			variantOf[s.Name] = u.Name
+			for _, f := range v.pkg.StructFields(s) {
+				if WireName(f) == u.Discriminator() {
+					msg := fmt.Sprintf("Field %s of %s has the same name as the discriminator of union %s",
+						f.Name, s.Name, u.Name)
+					v.AddErr(posErr(f.Pos, CodeInvalidUnion, msg))
+				}
+			}
+		}
+	}
+}
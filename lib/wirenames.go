@@ -0,0 +1,144 @@
+package polygenlib
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The wire name of a struct field is the name of its property in JSON.
+// It is given by a json entry in the field's tag, e.g.
+//
+//	UserId int `json:user_id`
+//
+// or else derived from the field name by the package's wire case, which
+// is declared with an annotation in the package doc comment:
+//
+//	//polygen:wire snake_case
+//	package svc
+//
+// In camelCase, the default, the leading capitals of the field name are
+// lowercased: Id is sent as id and URLPath as urlPath. In snake_case,
+// words are separated by underscores: URLPath is sent as url_path.
+const (
+	CamelCase = "camelCase"
+	SnakeCase = "snake_case"
+)
+
+// checkWireCase checks the value of a wire annotation is a known case
+func checkWireCase(val string) error {
+	if val != CamelCase && val != SnakeCase {
+		return fmt.Errorf("'wire' must be %s or %s (not %s)", CamelCase, SnakeCase, val)
+	}
+	return nil
+}
+
+// WireName returns the name of the struct field prop on the wire. This is
+// the JsonName set by the parser, or the field name in camelCase for
+// properties that have none.
+func WireName(prop Property) string {
+	if prop.JsonName != "" {
+		return prop.JsonName
+	}
+	return wireCaseName(prop.Name, CamelCase)
+}
+
+// wireCaseName returns the wire name of the field name in the given case
+func wireCaseName(name string, wireCase string) string {
+	runes := []rune(name)
+	if wireCase == SnakeCase {
+		out := make([]rune, 0, len(runes)+4)
+		for i, r := range runes {
+			// a capital starts a word if it follows a lowercase letter or
+			// digit, or is the last capital of an acronym (the L in URLPath)
+			if i > 0 && unicode.IsUpper(r) && runes[i-1] != '_' &&
+				(!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				out = append(out, '_')
+			}
+			out = append(out, unicode.ToLower(r))
+		}
+		return string(out)
+	}
+
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// jsonTagName returns the wire name given by the json entry of a field
+// tag, or an empty string if there is none. Options after a comma, as in
+// Go's encoding/json, are ignored.
+func jsonTagName(tag string) (string, error) {
+	entries, err := ParseTag(tag)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.Key != "json" {
+			continue
+		}
+		name := strings.Split(e.Value, ",")[0]
+		if name == "-" {
+			return "", fmt.Errorf("Fields may not be omitted from the wire with json:\"-\"")
+		} else if name == "" {
+			return "", fmt.Errorf("'json' must give a name")
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+// setWireNames sets the JsonName of struct fields without a json tag
+// entry, once the package's wire case is known
+func (v *Visitor) setWireNames() {
+	wireCase := v.pkg.WireCase
+	if wireCase == "" {
+		wireCase = CamelCase
+	}
+	for i := 0; i < len(v.pkg.Structs); i++ {
+		s := &v.pkg.Structs[i]
+		for x := 0; x < len(s.Props); x++ {
+			if s.Props[x].JsonName == "" {
+				s.Props[x].JsonName = wireCaseName(s.Props[x].Name, wireCase)
+			}
+		}
+	}
+}
+
+// checkWireNames checks that no two fields of a struct, including the
+// fields of embedded structs, have names that differ only in case or the
+// same wire name. Fields declared by the struct itself are reported at
+// their position, and duplicates between embedded structs at the struct.
+func (v *Visitor) checkWireNames() {
+	for i := 0; i < len(v.pkg.Structs); i++ {
+		s := &v.pkg.Structs[i]
+		fields := v.pkg.StructFields(s)
+		own := len(fields) - len(s.Props)
+		names := make(nameScope)
+		seen := make(map[string]declaredName)
+		for x, prop := range fields {
+			pos := s.Pos
+			if x >= own {
+				pos = prop.Pos
+			}
+			d := declaredName{"Field " + s.Name + "." + prop.Name, prop.Name, pos}
+			if !v.declare(names, d) {
+				continue
+			}
+			name := WireName(prop)
+			prev, ok := seen[name]
+			if !ok {
+				seen[name] = d
+				continue
+			}
+			msg := fmt.Sprintf("Fields %s and %s of struct %s have the same wire name %s", prev.name, prop.Name, s.Name, name)
+			e := posErr(pos, CodeDuplicateField, msg)
+			e.Related = []PolyError{*posErr(prev.pos, "", prev.what+" is declared here")}
+			v.AddErr(e)
+		}
+	}
+}
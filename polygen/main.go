@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	polygen "github.com/coopernurse/polygen/lib"
@@ -9,6 +10,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 func generate(p *polygen.Package, g polygen.CodeGenerator, dir string) error {
@@ -31,9 +34,59 @@ func generate(p *polygen.Package, g polygen.CodeGenerator, dir string) error {
 	return nil
 }
 
+// reportErrors writes the IDL errors in err to stderr, each with an excerpt
+// of the source it refers to, or as a JSON array to stdout if format is
+// "json". Then exits with status 1.
+func reportErrors(err error, format string) {
+	errs := polygen.Diagnostics(err)
+	if format == "json" {
+		out, _ := json.MarshalIndent(errs, "", "  ")
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	sources := make(map[string][]byte)
+	for _, e := range errs {
+		src, ok := sources[e.Filename]
+		if !ok && e.Filename != "" {
+			src, _ = ioutil.ReadFile(e.Filename)
+			sources[e.Filename] = src
+		}
+		fmt.Fprintln(os.Stderr, e.Excerpt(src))
+	}
+	os.Exit(1)
+}
+
+// checkIdentifiers returns the errors found by the IdentifierCheckers in
+// generators, in the order of names. Generators for the same language
+// report the same errors, so each is only returned once.
+func checkIdentifiers(pkg *polygen.Package, generators map[string]polygen.CodeGenerator,
+	names []string, escape bool) polygen.ErrorList {
+	errs := make(polygen.ErrorList, 0)
+	seen := make(map[string]bool)
+	for _, name := range names {
+		c, ok := generators[name].(polygen.IdentifierChecker)
+		if !ok {
+			continue
+		}
+		if err := c.CheckIdentifiers(pkg, escape); err != nil {
+			for _, e := range polygen.Diagnostics(err) {
+				key := e.Excerpt(nil)
+				if !seen[key] {
+					seen[key] = true
+					errs = append(errs, e)
+				}
+			}
+		}
+	}
+	return errs
+}
+
 func usage() string {
 	b := bytes.Buffer{}
-	b.WriteString("usage: polygen [options] idlfile\n")
+	b.WriteString("usage: polygen [options] idlfile [idlfile ...]\n")
+	b.WriteString("       polygen [options] idldir\n")
+	b.WriteString("       polygen [options] ir.json\n")
 	flag.VisitAll(func(f *flag.Flag) {
 		b.WriteString(fmt.Sprintf("  -%s=%s: %s)\n", f.Name, f.DefValue, f.Usage))
 	})
@@ -43,32 +96,66 @@ func usage() string {
 func main() {
 	var dir string
 	var clean bool
+	var errFormat string
+	var dumpIR bool
+	var escape bool
 	flag.StringVar(&dir, "dir", ".", "directory to write files to")
 	flag.BoolVar(&clean, "c", false, "delete existing files from dirs")
+	flag.StringVar(&errFormat, "errors", "text", "format of IDL errors: text or json")
+	flag.BoolVar(&escape, "escape", false, "rename names reserved in a target language (e.g. class to class_) instead of reporting them")
+	flag.BoolVar(&dumpIR, "dump-ir", false, "write the parsed IDL to stdout as JSON instead of generating code")
 	flag.Parse()
+	if errFormat != "text" && errFormat != "json" {
+		log.Fatal(usage())
+	}
 
 	args := flag.Args()
 	if len(args) < 1 {
 		log.Fatal(usage())
 	}
 
-	fname := args[0]
-	log.Printf("Reading IDL from: %s", fname)
-
-	idl, err := ioutil.ReadFile(fname)
+	var pkg *polygen.Package
+	fi, err := os.Stat(args[0])
 	if err != nil {
-		log.Fatal(err)
+		reportErrors(err, errFormat)
+	}
+	if len(args) == 1 && strings.HasSuffix(args[0], ".json") {
+		log.Printf("Reading IR from: %s", args[0])
+		pkg, err = polygen.ReadIR(args[0])
+	} else if len(args) == 1 && fi.IsDir() {
+		log.Printf("Reading IDL from directory: %s", args[0])
+		pkg, err = polygen.ParseDir(args[0])
+	} else {
+		log.Printf("Reading IDL from: %s", strings.Join(args, ", "))
+		pkg, err = polygen.ParseFiles(args)
 	}
-
-	pkg, err := polygen.Parse(fname, string(idl))
 	if err != nil {
-		log.Fatal(err)
+		reportErrors(err, errFormat)
+	}
+
+	if dumpIR {
+		out, err := polygen.MarshalIR(pkg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(out))
+		return
 	}
 
 	generators := make(map[string]polygen.CodeGenerator)
 	generators["java"] = polygen.JavaGenerator{}
 	generators["js"] = polygen.JsGenerator{}
 	generators["node"] = polygen.NodeJsGenerator{}
+	generators["schema"] = polygen.JsonSchemaGenerator{}
+
+	names := make([]string, 0, len(generators))
+	for subdir := range generators {
+		names = append(names, subdir)
+	}
+	sort.Strings(names)
+	if errs := checkIdentifiers(pkg, generators, names, escape); len(errs) > 0 {
+		reportErrors(errs, errFormat)
+	}
 
 	for subdir, gen := range generators {
 		dest := filepath.Join(dir, subdir)